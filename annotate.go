@@ -0,0 +1,76 @@
+package ursonnet
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SourcesAnnotation is the annotation AnnotateSources sets on Kubernetes objects.
+const SourcesAnnotation = "ursonnet.kubecfg.io/sources"
+
+// AnnotateSources returns the JSON output with the SourcesAnnotation of every Kubernetes object set to the
+// sources of its values: the roots of its leaves in blame (as returned by Cache.Blame), deduplicated and
+// sorted by file and line, like `base.libsonnet:3,env.jsonnet:12`.
+func AnnotateSources(output string, blame map[string][]string) (string, error) {
+	v, err := decodeJSON(output)
+	if err != nil {
+		return "", err
+	}
+	for _, o := range objectsOf(v) {
+		lines := map[string]map[int]bool{}
+		for path, roots := range blame {
+			if path != o.Path && !nestedIn(path, o.Path) {
+				continue
+			}
+			for _, r := range roots {
+				file, line, err := ParseRoot(r)
+				if err != nil {
+					return "", err
+				}
+				if lines[file] == nil {
+					lines[file] = map[int]bool{}
+				}
+				lines[file][line] = true
+			}
+		}
+		setAnnotation(o.Value, SourcesAnnotation, formatSources(lines))
+	}
+	return toJSON(v), nil
+}
+
+// formatSources lists file:line pairs, sorted by file and line.
+func formatSources(lines map[string]map[int]bool) string {
+	files := make([]string, 0, len(lines))
+	for f := range lines {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	var res []string
+	for _, f := range files {
+		ns := make([]int, 0, len(lines[f]))
+		for n := range lines[f] {
+			ns = append(ns, n)
+		}
+		sort.Ints(ns)
+		for _, n := range ns {
+			res = append(res, f+":"+strconv.Itoa(n))
+		}
+	}
+	return strings.Join(res, ",")
+}
+
+// setAnnotation sets metadata.annotations[key] on a Kubernetes object, creating the maps as needed.
+func setAnnotation(obj map[string]interface{}, key, value string) {
+	metadata, ok := obj["metadata"].(map[string]interface{})
+	if !ok {
+		metadata = map[string]interface{}{}
+		obj["metadata"] = metadata
+	}
+	annotations, ok := metadata["annotations"].(map[string]interface{})
+	if !ok {
+		annotations = map[string]interface{}{}
+		metadata["annotations"] = annotations
+	}
+	annotations[key] = value
+}
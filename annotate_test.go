@@ -0,0 +1,91 @@
+package ursonnet
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+)
+
+func TestAnnotateSources(t *testing.T) {
+	output := `{
+  "a": {"apiVersion": "v1", "kind": "ConfigMap", "data": {"x": "1", "y": "2"}},
+  "ab": {"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "s", "annotations": {"keep": "me"}}},
+  "other": {"x": 1}
+}`
+	blame := map[string][]string{
+		"$.a.apiVersion": {"b.libsonnet:3 "},
+		"$.a.kind":       {"b.libsonnet:3 "},
+		"$.a.data.x":     {"env.jsonnet:12 ", "b.libsonnet:10 "},
+		"$.a.data.y":     {"a.libsonnet:1 "},
+		// $.ab is not nested in $.a
+		"$.ab.kind":          {"c.libsonnet:2 "},
+		"$.ab.metadata.name": {"c.libsonnet:2 "},
+		"$.other.x":          {"d.libsonnet:1 "},
+	}
+	res, err := AnnotateSources(output, blame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(res), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"a": map[string]interface{}{
+			"apiVersion": "v1", "kind": "ConfigMap", "data": map[string]interface{}{"x": "1", "y": "2"},
+			"metadata": map[string]interface{}{"annotations": map[string]interface{}{
+				SourcesAnnotation: "a.libsonnet:1,b.libsonnet:3,b.libsonnet:10,env.jsonnet:12",
+			}},
+		},
+		"ab": map[string]interface{}{
+			"apiVersion": "v1", "kind": "Secret",
+			"metadata": map[string]interface{}{"name": "s", "annotations": map[string]interface{}{
+				"keep":            "me",
+				SourcesAnnotation: "c.libsonnet:2",
+			}},
+		},
+		"other": map[string]interface{}{"x": 1.0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AnnotateSources() = %s", res)
+	}
+
+	if _, err := AnnotateSources(output, map[string][]string{"$.a.kind": {"nope"}}); err == nil {
+		t.Error("AnnotateSources() with an invalid root: got no error")
+	}
+}
+
+func TestAnnotateSourcesBlame(t *testing.T) {
+	c := NewCache(jsonnet.MakeVM)
+	output, err := c.Evaluate("testdata/child.jsonnet", "$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blame, err := c.Blame("testdata/child.jsonnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := AnnotateSources(output, blame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Deployment struct {
+			Metadata struct {
+				Annotations map[string]string
+			}
+		}
+	}
+	if err := json.Unmarshal([]byte(res), &got); err != nil {
+		t.Fatal(err)
+	}
+	const want = "testdata/base.jsonnet:5,testdata/base.jsonnet:6,testdata/base.jsonnet:8," +
+		"testdata/common.libsonnet:7,testdata/common.libsonnet:8,testdata/common.libsonnet:10,testdata/common.libsonnet:15," +
+		"testdata/common.libsonnet:20,testdata/common.libsonnet:22,testdata/common.libsonnet:23,testdata/common.libsonnet:27," +
+		"testdata/config.libsonnet:2,testdata/config.libsonnet:4,testdata/config.libsonnet:5"
+	if got := got.Deployment.Metadata.Annotations[SourcesAnnotation]; got != want {
+		t.Errorf("the sources of the deployment are %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,411 @@
+package ursonnet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/google/go-jsonnet/toolutils"
+)
+
+// Cache answers queries on jsonnet files keeping them parsed, with their imports expanded and instrumented
+// for Roots, across queries. Files are checked for changes at every query: a changed file is dropped from
+// the cache together with all the files importing it.
+//
+// A Cache is safe for concurrent use, but queries are answered one at a time.
+type Cache struct {
+	newVM func() *jsonnet.VM
+
+	mu sync.Mutex
+	vm *jsonnet.VM
+	// files holds the instrumented ASTs by import path, as expandImports wants them.
+	files map[string]ast.Node
+	// instrumented holds the nodes of files, so that injectTrace skips them.
+	instrumented map[ast.Node]bool
+	// deps holds the absolute paths of the files that each cached file is made of, itself included.
+	deps   map[string]map[string]bool
+	stamps map[string]stamp
+	blame  map[string]map[string][]string
+}
+
+type stamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewCache returns an empty cache evaluating with VMs returned by newVM. A new VM is used after files change,
+// since the VM caches imported files.
+func NewCache(newVM func() *jsonnet.VM) *Cache {
+	c := &Cache{newVM: newVM}
+	c.reset()
+	return c
+}
+
+func (c *Cache) reset() {
+	c.vm = c.newVM()
+	c.files = map[string]ast.Node{}
+	c.instrumented = map[ast.Node]bool{}
+	c.deps = map[string]map[string]bool{}
+	c.stamps = map[string]stamp{}
+	c.blame = map[string]map[string][]string{}
+}
+
+// Roots is like the Roots function. The roots of output leaves already blamed aren't computed again.
+func (c *Cache) Roots(filename string, expr string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.refresh()
+	if roots, ok := c.blame[filename][expr]; ok {
+		return roots, nil
+	}
+	roots, _, err := c.evaluate(filename, expr)
+	return roots, err
+}
+
+// Evaluate returns the JSON value of expr evaluated in the context of filename, like Roots does.
+func (c *Cache) Evaluate(filename string, expr string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.refresh()
+	_, res, err := c.evaluate(filename, expr)
+	return res, err
+}
+
+// Blame returns the roots of every scalar value, empty object and empty array in the output of filename,
+// by field path.
+func (c *Cache) Blame(filename string) (map[string][]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.refresh()
+	return c.blameFile(filename)
+}
+
+// Sources returns the absolute paths of the files the output of filename is made of, sorted: the entrypoint,
+// the files it imports, recursively, and the files they importstr or importbin.
+func (c *Cache) Sources(filename string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.refresh()
+	if _, _, err := c.evaluate(filename, "$"); err != nil {
+		return nil, err
+	}
+	foundAt, err := c.vm.ResolveImport(ursonnetTraceTag, filename)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for f := range c.deps[foundAt] {
+		res = append(res, f)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// Impact returns the field paths of the values in the output of filename that have the given root,
+// written as "file:line". The file is matched like it is for overrides.
+func (c *Cache) Impact(filename string, root string) ([]string, error) {
+	file, line, err := ParseRoot(root)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.refresh()
+	blame, err := c.blameFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for path, roots := range blame {
+		for _, r := range roots {
+			if f, l, err := ParseRoot(r); err == nil && l == line && matchesFile(f, file) {
+				res = append(res, path)
+				break
+			}
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// Invalidate drops the given files from the cache, together with the files importing them,
+// and returns the import paths of the dropped files. Files that didn't change can be invalidated too,
+// e.g. when they are edited in memory.
+func (c *Cache) Invalidate(files ...string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.invalidate(files)
+}
+
+func (c *Cache) invalidate(files []string) []string {
+	changed := map[string]bool{}
+	for _, f := range files {
+		if abs, err := filepath.Abs(f); err == nil {
+			changed[abs] = true
+		}
+	}
+
+	var dropped []string
+	for foundAt, deps := range c.deps {
+		for f := range changed {
+			if deps[f] {
+				dropped = append(dropped, foundAt)
+				break
+			}
+		}
+	}
+	for f := range changed {
+		delete(c.stamps, f)
+	}
+	if len(dropped) == 0 {
+		return nil
+	}
+	sort.Strings(dropped)
+
+	for _, foundAt := range dropped {
+		delete(c.files, foundAt)
+		delete(c.deps, foundAt)
+	}
+	c.vm = c.newVM()
+	c.blame = map[string]map[string][]string{}
+	c.instrumented = map[ast.Node]bool{}
+	for _, a := range c.files {
+		markInstrumented(a, c.instrumented)
+	}
+	return dropped
+}
+
+// refresh invalidates the files changed since they were cached.
+func (c *Cache) refresh() {
+	var changed []string
+	for f, s := range c.stamps {
+		if cur, err := statFile(f); err != nil || cur != s {
+			changed = append(changed, f)
+		}
+	}
+	if len(changed) > 0 {
+		c.invalidate(changed)
+	}
+}
+
+// evaluate evaluates expr like Roots does, reusing and filling the cache.
+func (c *Cache) evaluate(filename string, expr string) ([]string, string, error) {
+	root, err := queryAST(filename, expr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	before := map[string]bool{}
+	for f := range c.files {
+		before[f] = true
+	}
+	root, err = expandImports(c.vm, root, c.files, nil)
+	if err != nil {
+		// don't keep the files whose imports are only partially expanded
+		for f := range c.files {
+			if !before[f] {
+				delete(c.files, f)
+			}
+		}
+		return nil, "", err
+	}
+	for f, a := range c.files {
+		if !before[f] {
+			if err := injectTrace(a, c.instrumented); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	if root, err = liftFunction(c.vm, root, filename, c.files, true); err != nil {
+		return nil, "", err
+	}
+	query := c.queryNodes(root)
+	err = injectTrace(root, c.instrumented)
+	for a := range query {
+		delete(c.instrumented, a)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	for f, a := range c.files {
+		if !before[f] {
+			c.addDeps(f, a)
+		}
+	}
+
+	var traceOut bytes.Buffer
+	c.vm.SetTraceOut(&traceOut)
+	res, err := c.vm.Evaluate(root)
+	if err != nil {
+		return nil, "", err
+	}
+	return tracedRoots(&traceOut), res, nil
+}
+
+// addDeps records the files a cached AST is made of: the files of its nodes and the files they importstr.
+func (c *Cache) addDeps(foundAt string, a ast.Node) {
+	deps := map[string]bool{}
+	add := func(f string) {
+		if f == "" {
+			return // synthesized nodes
+		}
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return
+		}
+		s, err := statFile(abs)
+		if err != nil {
+			return // e.g. the query snippet
+		}
+		deps[abs] = true
+		if _, ok := c.stamps[abs]; !ok {
+			c.stamps[abs] = s
+		}
+	}
+	add(foundAt)
+
+	seen, names := map[ast.Node]bool{}, map[string]bool{}
+	var walk func(a ast.Node)
+	walk = func(a ast.Node) {
+		if a == nil || seen[a] {
+			return
+		}
+		seen[a] = true
+		loc := a.Loc()
+		if !names[loc.FileName] {
+			names[loc.FileName] = true
+			add(loc.FileName)
+		}
+		var imported string
+		switch a := a.(type) {
+		case *ast.ImportStr:
+			imported = a.File.Value
+		case *ast.ImportBin:
+			imported = a.File.Value
+		}
+		if imported != "" {
+			if f, err := c.vm.ResolveImport(loc.FileName, imported); err == nil {
+				add(f)
+			}
+		}
+		for _, ch := range toolutils.Children(a) {
+			walk(ch)
+		}
+	}
+	walk(a)
+	c.deps[foundAt] = deps
+}
+
+func (c *Cache) blameFile(filename string) (map[string][]string, error) {
+	if res, ok := c.blame[filename]; ok {
+		return res, nil
+	}
+	_, out, err := c.evaluate(filename, "$")
+	if err != nil {
+		return nil, err
+	}
+	paths, err := leafPaths(out)
+	if err != nil {
+		return nil, err
+	}
+	res := map[string][]string{}
+	for _, p := range paths {
+		roots, _, err := c.evaluate(filename, p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		res[p] = roots
+	}
+	c.blame[filename] = res
+	return res, nil
+}
+
+// leafPaths returns the field paths of the scalars, empty objects and empty arrays of a JSON value.
+func leafPaths(output string) ([]string, error) {
+	d := json.NewDecoder(strings.NewReader(output))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil && err != io.EOF {
+		return nil, err
+	}
+	var res []string
+	var walk func(p fieldPath, v interface{})
+	walk = func(p fieldPath, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if len(v) == 0 {
+				res = append(res, p.String())
+			}
+			for k, e := range v {
+				walk(p.append(pathElem{Field: k}), e)
+			}
+		case []interface{}:
+			if len(v) == 0 {
+				res = append(res, p.String())
+			}
+			for i, e := range v {
+				walk(p.append(pathElem{Index: i, IsIndex: true}), e)
+			}
+		default:
+			res = append(res, p.String())
+		}
+	}
+	walk(nil, v)
+	return res, nil
+}
+
+// queryNodes returns the nodes of the query snippet, i.e. the ones that are neither instrumented nor part of
+// the cached files, before the query is instrumented. These are not kept in the instrumented nodes.
+func (c *Cache) queryNodes(root ast.Node) map[ast.Node]bool {
+	files := map[ast.Node]bool{}
+	for _, a := range c.files {
+		files[a] = true
+	}
+	res := map[ast.Node]bool{}
+	var walk func(a ast.Node)
+	walk = func(a ast.Node) {
+		if a == nil || files[a] || c.instrumented[a] || res[a] {
+			return
+		}
+		res[a] = true
+		for _, ch := range toolutils.Children(a) {
+			walk(ch)
+		}
+	}
+	walk(root)
+	return res
+}
+
+func markInstrumented(a ast.Node, seen map[ast.Node]bool) {
+	if a == nil || seen[a] {
+		return
+	}
+	seen[a] = true
+	for _, c := range toolutils.Children(a) {
+		markInstrumented(c, seen)
+	}
+}
+
+func statFile(f string) (stamp, error) {
+	fi, err := os.Stat(f)
+	if err != nil {
+		return stamp{}, err
+	}
+	return stamp{modTime: fi.ModTime(), size: fi.Size()}, nil
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/kubecfg/ursonnet"
+)
+
+// schemaVersion is the version of the json and jsonl formats, bumped on incompatible changes.
+const schemaVersion = 1
+
+const (
+	// maxMarkdownFields, maxMarkdownRoots and maxMarkdownValue keep markdown reports small enough for a PR comment.
+	maxMarkdownFields = 50
+	maxMarkdownRoots  = 3
+	maxMarkdownValue  = 60
+)
+
+// fieldRoots is the result of a query on a field.
+type fieldRoots struct {
+	Path string
+	// Value is the JSON value of the field; empty if the field was removed.
+	Value string
+	// Before is the previous JSON value of a changed field; empty if the field was added.
+	Before  string
+	Changed bool
+	Roots   []string
+	// Verified is set with --verify, in the same order as Roots.
+	Verified []ursonnet.VerifiedRoot
+	// Secret is set for the values influenced by secrets, which are redacted.
+	Secret bool
+}
+
+// status returns the verification status of the i-th root, if verified.
+func (r fieldRoots) status(i int) string {
+	if r.Verified == nil {
+		return ""
+	}
+	return string(r.Verified[i].Status)
+}
+
+// message describes the field for the formats reporting one line per root.
+func (r fieldRoots) message(i int) string {
+	msg := r.Path
+	switch {
+	case r.Changed && r.Before == "":
+		msg += " = " + r.Value + " (added)"
+	case r.Changed:
+		msg += ": " + r.Before + " -> " + r.Value
+	default:
+		msg += " = " + r.Value
+	}
+	if r.Secret {
+		msg += " (secret)"
+	}
+	if s := r.status(i); s != "" {
+		msg += " (" + s + ")"
+	}
+	return msg
+}
+
+// writeText writes the roots of each field, under the field path if there are several fields.
+// With hyperlinks the roots are OSC 8 terminal hyperlinks to the files.
+func writeText(w io.Writer, results []fieldRoots, hyperlinks bool) {
+	for _, r := range results {
+		indent := ""
+		if len(results) > 1 || r.Changed {
+			fmt.Fprintln(w, r.Path)
+			indent = "  "
+		}
+		for i, root := range r.Roots {
+			if hyperlinks {
+				root = hyperlink(root)
+			}
+			if s := r.status(i); s != "" {
+				root = strings.TrimSpace(root) + " " + s
+			}
+			fmt.Fprintf(w, "%s%s\n", indent, root)
+		}
+	}
+}
+
+// hyperlink wraps a root in an OSC 8 escape sequence linking to its file.
+func hyperlink(root string) string {
+	file, _, err := ursonnet.ParseRoot(root)
+	if err != nil {
+		return root
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return root
+	}
+	host, _ := os.Hostname()
+	u := url.URL{Scheme: "file", Host: host, Path: filepath.ToSlash(abs)}
+	return fmt.Sprintf("\x1b]8;;%s\x1b\\%s\x1b]8;;\x1b\\ ", u.String(), strings.TrimSpace(root))
+}
+
+// writeVimgrep writes one `file:line:col: message` line per root, for editor quickfix lists.
+func writeVimgrep(w io.Writer, results []fieldRoots) {
+	for _, r := range results {
+		for i, root := range r.Roots {
+			if file, line, err := ursonnet.ParseRoot(root); err == nil {
+				fmt.Fprintf(w, "%s:%d:1: %s\n", file, line, oneLine(r.message(i)))
+			}
+		}
+	}
+}
+
+// writeGitHub writes one GitHub Actions notice annotation per root.
+func writeGitHub(w io.Writer, results []fieldRoots) {
+	for _, r := range results {
+		for i, root := range r.Roots {
+			if file, line, err := ursonnet.ParseRoot(root); err == nil {
+				fmt.Fprintf(w, "::notice file=%s,line=%d,title=ursonnet::%s\n",
+					escapeProperty(repoPath(file)), line, escapeData(r.message(i)))
+			}
+		}
+	}
+}
+
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeProperty(s string) string {
+	return strings.NewReplacer(":", "%3A", ",", "%2C").Replace(escapeData(s))
+}
+
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+type jsonRoot struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Status string `json:"status,omitempty"`
+}
+
+type jsonField struct {
+	Path    string          `json:"path"`
+	Value   json.RawMessage `json:"value,omitempty"`
+	Before  json.RawMessage `json:"before,omitempty"`
+	Changed bool            `json:"changed,omitempty"`
+	Secret  bool            `json:"secret,omitempty"`
+	Roots   []jsonRoot      `json:"roots"`
+}
+
+func toJSONField(r fieldRoots) jsonField {
+	f := jsonField{Path: r.Path, Changed: r.Changed, Secret: r.Secret, Roots: []jsonRoot{}}
+	if r.Value != "" {
+		f.Value = json.RawMessage(r.Value)
+	}
+	if r.Before != "" {
+		f.Before = json.RawMessage(r.Before)
+	}
+	for i, root := range r.Roots {
+		if file, line, err := ursonnet.ParseRoot(root); err == nil {
+			f.Roots = append(f.Roots, jsonRoot{File: file, Line: line, Status: r.status(i)})
+		}
+	}
+	return f
+}
+
+// writeJSON writes a single JSON document with all the fields.
+func writeJSON(w io.Writer, entrypoint string, results []fieldRoots) error {
+	doc := struct {
+		SchemaVersion int         `json:"schemaVersion"`
+		Entrypoint    string      `json:"entrypoint"`
+		Fields        []jsonField `json:"fields"`
+	}{SchemaVersion: schemaVersion, Entrypoint: entrypoint, Fields: []jsonField{}}
+	for _, r := range results {
+		doc.Fields = append(doc.Fields, toJSONField(r))
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	e.SetEscapeHTML(false)
+	return e.Encode(doc)
+}
+
+// writeJSONLine writes one field as a JSON line, so that results can be streamed as they are computed.
+func writeJSONLine(w io.Writer, entrypoint string, r fieldRoots) error {
+	e := json.NewEncoder(w)
+	e.SetEscapeHTML(false)
+	return e.Encode(struct {
+		SchemaVersion int    `json:"schemaVersion"`
+		Entrypoint    string `json:"entrypoint"`
+		jsonField
+	}{schemaVersion, entrypoint, toJSONField(r)})
+}
+
+// writeMarkdown writes a table of the fields with their values and links to their roots.
+// Links are relative to the repository root, prefixed by linkBase.
+func writeMarkdown(w io.Writer, entrypoint string, results []fieldRoots, changes bool, linkBase string) {
+	what := "fields"
+	if len(results) == 1 {
+		what = "field"
+	}
+	if changes {
+		fmt.Fprintf(w, "**ursonnet**: %d changed %s in `%s`\n\n", len(results), what, entrypoint)
+	} else {
+		fmt.Fprintf(w, "**ursonnet**: roots of %d %s in `%s`\n\n", len(results), what, entrypoint)
+	}
+	if len(results) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "| Field | Value | Roots |")
+	fmt.Fprintln(w, "| --- | --- | --- |")
+	for i, r := range results {
+		if i == maxMarkdownFields {
+			fmt.Fprintf(w, "\n…and %d more fields.\n", len(results)-i)
+			break
+		}
+		value := code(r.Value)
+		switch {
+		case r.Changed && r.Before == "":
+			value += " (added)"
+		case r.Changed && r.Value == "":
+			value = code(r.Before) + " (removed)"
+		case r.Changed:
+			value = code(r.Before) + " → " + value
+		}
+		if r.Secret {
+			value += " (secret)"
+		}
+
+		var links []string
+		for j, root := range r.Roots {
+			if j == maxMarkdownRoots {
+				links = append(links, fmt.Sprintf("+%d more", len(r.Roots)-j))
+				break
+			}
+			link := markdownLink(root, linkBase)
+			if r.Verified != nil && r.Verified[j].Status != ursonnet.RootConfirmed {
+				link += " _" + string(r.Verified[j].Status) + "_"
+			}
+			links = append(links, link)
+		}
+		fmt.Fprintf(w, "| %s | %s | %s |\n", code(r.Path), value, strings.Join(links, ", "))
+	}
+}
+
+// code formats s as a markdown code span fit for a table cell.
+func code(s string) string {
+	if s == "" {
+		return ""
+	}
+	if n := []rune(s); len(n) > maxMarkdownValue {
+		s = string(n[:maxMarkdownValue-1]) + "…"
+	}
+	s = strings.ReplaceAll(s, "|", `\|`)
+	if strings.Contains(s, "`") {
+		return "`` " + s + " ``"
+	}
+	return "`" + s + "`"
+}
+
+func markdownLink(root, linkBase string) string {
+	file, line, err := ursonnet.ParseRoot(root)
+	if err != nil {
+		return strings.TrimSpace(root)
+	}
+	file = repoPath(file)
+	return fmt.Sprintf("[%s:%d](%s%s#L%d)", path.Base(file), line, linkBase, file, line)
+}
+
+// repoPath returns the path of file relative to the root of the git repository containing it,
+// or file itself outside of repositories.
+func repoPath(file string) string {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return filepath.ToSlash(file)
+	}
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			if rel, err := filepath.Rel(dir, abs); err == nil {
+				return filepath.ToSlash(rel)
+			}
+		}
+		if dir == filepath.Dir(dir) {
+			return filepath.ToSlash(file)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONFormats(t *testing.T) {
+	results := []fieldRoots{
+		{Path: "$.a", Value: `"<redacted>"`, Secret: true, Roots: []string{"main.jsonnet:2 "}},
+		{Path: "$.b", Value: "2", Before: "1", Changed: true, Roots: []string{"lib.libsonnet:3"}},
+		{Path: "$.c", Value: "3", Changed: true, Roots: []string{"main.jsonnet:4"}},
+		{Path: "$.d", Before: `"x & y"`, Changed: true},
+	}
+
+	var doc bytes.Buffer
+	if err := writeJSON(&doc, "main.jsonnet", results); err != nil {
+		t.Fatal(err)
+	}
+	var lines bytes.Buffer
+	for _, r := range results {
+		if err := writeJSONLine(&lines, "main.jsonnet", r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, out := range []string{doc.String(), lines.String()} {
+		if strings.Contains(out, `\u00`) {
+			t.Errorf("HTML characters are escaped:\n%s", out)
+		}
+	}
+
+	var parsed struct {
+		SchemaVersion int               `json:"schemaVersion"`
+		Entrypoint    string            `json:"entrypoint"`
+		Fields        []json.RawMessage `json:"fields"`
+	}
+	if err := json.Unmarshal(doc.Bytes(), &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.SchemaVersion != schemaVersion || parsed.Entrypoint != "main.jsonnet" {
+		t.Errorf("bad header: %s", doc.String())
+	}
+	var fromDoc, fromLines []map[string]interface{}
+	for _, f := range parsed.Fields {
+		var m map[string]interface{}
+		if err := json.Unmarshal(f, &m); err != nil {
+			t.Fatal(err)
+		}
+		fromDoc = append(fromDoc, m)
+	}
+	for _, l := range strings.Split(strings.TrimSpace(lines.String()), "\n") {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(l), &m); err != nil {
+			t.Fatal(err)
+		}
+		if m["schemaVersion"] != float64(schemaVersion) || m["entrypoint"] != "main.jsonnet" {
+			t.Errorf("bad header: %s", l)
+		}
+		delete(m, "schemaVersion")
+		delete(m, "entrypoint")
+		fromLines = append(fromLines, m)
+	}
+	if len(fromDoc) != len(results) {
+		t.Errorf("json reports %d fields, want %d", len(fromDoc), len(results))
+	}
+	if !reflect.DeepEqual(fromDoc, fromLines) {
+		t.Errorf("json and jsonl differ:\n%s\n%s", doc.String(), lines.String())
+	}
+}
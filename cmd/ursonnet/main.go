@@ -1,11 +1,26 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/alecthomas/kong"
 	"github.com/google/go-jsonnet"
 	"github.com/kubecfg/ursonnet"
+	"github.com/kubecfg/ursonnet/internal/dap"
+	"github.com/kubecfg/ursonnet/internal/htmlreport"
+	"github.com/kubecfg/ursonnet/internal/lsp"
+	"github.com/kubecfg/ursonnet/internal/server"
+	"github.com/kubecfg/ursonnet/internal/tui"
 )
 
 type Context struct {
@@ -13,24 +28,797 @@ type Context struct {
 }
 
 type CLI struct {
+	Debug bool `short:"d"`
+	VMFlags
+
+	Roots      RootsCmd      `cmd:"" default:"withargs" help:"Print the source locations that affect the value of a field."`
+	Suggest    SuggestCmd    `cmd:"" help:"Print the source location to edit in order to change the value of a field."`
+	Set        SetCmd        `cmd:"" help:"Replace the literal that produces the value of a field, keeping the rest of the file as is."`
+	Whatif     WhatifCmd     `cmd:"" help:"Show how the value of a field and the rest of the output change with some overrides, without editing files."`
+	Slice      SliceCmd      `cmd:"" help:"Print a minimal standalone jsonnet program that produces the value of a field. Entrypoints whose top level is a function are not supported."`
+	Run        RunCmd        `cmd:"" help:"Evaluate a jsonnet file, printing the values of logpoint expressions as fields are evaluated."`
+	Lsp        LspCmd        `cmd:"" help:"Run a language server over stdio, resolving definitions by evaluating an entrypoint."`
+	Dap        DapCmd        `cmd:"" help:"Run a debug adapter over stdio, with breakpoints on jsonnet fields."`
+	Explore    ExploreCmd    `cmd:"" help:"Browse the output of a jsonnet file in the terminal, showing the roots of the selected values."`
+	Serve      ServeCmd      `cmd:"" help:"Serve a local HTTP JSON API answering roots, blame, impact and eval queries from a warm cache."`
+	HTML       HTMLCmd       `cmd:"" name:"html" help:"Write a self-contained HTML page showing the output next to the sources, highlighting the roots of the values clicked."`
+	Drift      DriftCmd      `cmd:"" help:"Compare live objects saved as YAML with the output, printing the roots of the intended values of the fields that differ."`
+	Render     RenderCmd     `cmd:"" help:"Print the Kubernetes objects of a jsonnet file as YAML, like kubecfg show does, optionally annotated with their sources."`
+	Provenance ProvenanceCmd `cmd:"" help:"Print an in-toto statement with a SLSA provenance predicate linking the output of a jsonnet file to its sources."`
+	Report     ReportCmd     `cmd:"" help:"Print a table of the images, resources, replicas or namespaces of the Kubernetes objects of a jsonnet file, with their roots."`
+	Inputs     InputsCmd     `cmd:"" help:"List the ext vars, top-level arguments and literal fields that influence the output of a jsonnet file, with the values they affect."`
+	Influence  InfluenceCmd  `cmd:"" help:"Print the output values influenced by each ext var and top-level argument, flagging those influenced by secrets."`
+	At         AtCmd         `cmd:"" help:"Print the roots of the value at a line of the YAML rendered from a jsonnet file."`
+}
+
+type RootsCmd struct {
+	Path       string   `arg:""`
+	FieldPaths []string `arg:"" name:"field-path" default:"$" sep:"none" help:"jsonnet field paths or object addresses, example, $.a.b or apps/v1/Deployment/ns/foo:.spec.replicas"`
+	Verify     bool     `help:"Perturb each literal root and re-evaluate, to tell confirmed roots from incidental ones."`
+	Since      string   `placeholder:"FILE" help:"JSON output of the entrypoint before a change: report the values changed since, under the field paths."`
+	Format     string   `enum:"text,markdown,json,jsonl,vimgrep,github" default:"text" help:"Output format: text, markdown (a table for pull request comments), json, jsonl (a JSON line per field), vimgrep (file:line:col: message) or github (workflow annotations)."`
+	LinkBase   string   `help:"Prefix of the markdown links to the roots, which are relative to the repository root, example, https://github.com/org/repo/blob/main/"`
+	Hyperlinks bool     `help:"Print the roots as OSC 8 terminal hyperlinks to the files, in text format."`
+}
+
+func (cmd *RootsCmd) Run(cli *Context) error {
+	vm, err := cli.makeVM()
+	if err != nil {
+		return err
+	}
+	if cmd.FieldPaths, err = resolveAddresses(vm, cmd.Path, cmd.FieldPaths); err != nil {
+		return err
+	}
+
+	redactor, err := cli.redactor(cmd.Path)
+	if err != nil {
+		return err
+	}
+
+	var results []fieldRoots
+	if cmd.Since != "" {
+		before, err := os.ReadFile(cmd.Since)
+		if err != nil {
+			return err
+		}
+		after, err := ursonnet.Evaluate(vm, cmd.Path, "$")
+		if err != nil {
+			return err
+		}
+		changes, err := ursonnet.Diff(string(before), after)
+		if err != nil {
+			return fmt.Errorf("%s: %w", cmd.Since, err)
+		}
+		for _, c := range changes {
+			if under(c.Path, cmd.FieldPaths) {
+				results = append(results, fieldRoots{Path: c.Path, Value: c.After, Before: c.Before, Changed: true})
+			}
+		}
+	} else {
+		for _, p := range cmd.FieldPaths {
+			results = append(results, fieldRoots{Path: p})
+		}
+	}
+
+	for i, r := range results {
+		// removed fields have no value nor roots, but are reported like the others
+		if removed := r.Changed && r.Value == ""; !removed {
+			if err := cmd.explain(cli, vm, &results[i]); err != nil {
+				return err
+			}
+		}
+		// the values of removed fields are absent from the output, and redacted whenever there are secrets
+		if redactor.Secret(r.Path) {
+			results[i].Value = redactor.Value(r.Path, results[i].Value)
+			results[i].Before = redactor.Value(r.Path, results[i].Before)
+			results[i].Secret = true
+		}
+		if cmd.Format == "jsonl" {
+			if err := writeJSONLine(os.Stdout, cmd.Path, results[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch cmd.Format {
+	case "markdown":
+		writeMarkdown(os.Stdout, cmd.Path, results, cmd.Since != "", cmd.LinkBase)
+	case "json":
+		return writeJSON(os.Stdout, cmd.Path, results)
+	case "jsonl":
+		// already streamed
+	case "vimgrep":
+		writeVimgrep(os.Stdout, results)
+	case "github":
+		writeGitHub(os.Stdout, results)
+	default:
+		writeText(os.Stdout, results, cmd.Hyperlinks)
+	}
+	return nil
+}
+
+// explain fills in the value (unless already known), the roots and their verification of a field.
+func (cmd *RootsCmd) explain(cli *Context, vm *jsonnet.VM, r *fieldRoots) error {
+	if !r.Changed && cmd.Format != "text" {
+		value, err := ursonnet.Evaluate(vm, cmd.Path, r.Path)
+		if err != nil {
+			return err
+		}
+		var b bytes.Buffer
+		if err := json.Compact(&b, []byte(value)); err != nil {
+			return err
+		}
+		r.Value = b.String()
+	}
+	roots, err := ursonnet.Roots(vm, cmd.Path, r.Path, ursonnet.Debug(cli.Debug))
+	if err != nil {
+		return err
+	}
+	r.Roots = roots
+	if cmd.Verify {
+		if r.Verified, err = ursonnet.Verify(vm, cmd.Path, r.Path, roots); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveAddresses translates the object addresses among paths into field paths,
+// evaluating the entrypoint once if there are any.
+func resolveAddresses(vm *jsonnet.VM, filename string, paths []string) ([]string, error) {
+	var output string
+	res := make([]string, len(paths))
+	for i, p := range paths {
+		if !ursonnet.IsAddress(p) {
+			res[i] = p
+			continue
+		}
+		var err error
+		if output == "" {
+			if output, err = ursonnet.Evaluate(vm, filename, "$"); err != nil {
+				return nil, err
+			}
+		}
+		if res[i], err = ursonnet.AddressFieldPath(output, p); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// under reports whether the field path p is one of paths or nested in one of them.
+func under(p string, paths []string) bool {
+	for _, q := range paths {
+		if p == q || strings.HasPrefix(p, q+".") || strings.HasPrefix(p, q+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+type SuggestCmd struct {
+	Path      string `arg:""`
+	FieldPath string `arg:"" help:"jsonnet field path or object address, example, $.a.b or apps/v1/Deployment/ns/foo:.spec.replicas"`
+}
+
+func (cmd *SuggestCmd) Run(cli *Context) error {
+	vm, err := cli.makeVM()
+	if err != nil {
+		return err
+	}
+	if cmd.FieldPath, err = ursonnet.ResolveAddress(vm, cmd.Path, cmd.FieldPath); err != nil {
+		return err
+	}
+
+	res, err := ursonnet.Suggest(vm, cmd.Path, cmd.FieldPath, ursonnet.LibraryDirs(cli.jpaths()...))
+	if err != nil {
+		return err
+	}
+	fmt.Println(res)
+	return nil
+}
+
+type SetCmd struct {
+	Path      string `arg:""`
+	FieldPath string `arg:"" help:"jsonnet field path or object address, example, $.a.b or apps/v1/Deployment/ns/foo:.spec.replicas"`
+	Value     string `arg:"" help:"new value as a jsonnet expression, example, '\"4\"'"`
+	Layer     string `enum:"base,override" default:"base" help:"Edit the literal where it is defined (base) or override it in the entrypoint file (override)."`
+}
+
+func (cmd *SetCmd) Run(cli *Context) error {
+	vm, err := cli.makeVM()
+	if err != nil {
+		return err
+	}
+	if cmd.FieldPath, err = ursonnet.ResolveAddress(vm, cmd.Path, cmd.FieldPath); err != nil {
+		return err
+	}
+
+	edit, err := ursonnet.Set(vm, cmd.Path, cmd.FieldPath, cmd.Value, ursonnet.AtLayer(ursonnet.Layer(cmd.Layer)), ursonnet.SetLibraryDirs(cli.jpaths()...))
+	if err != nil {
+		return err
+	}
+	st, err := os.Stat(edit.Filename)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(edit.Filename, []byte(edit.Content), st.Mode()); err != nil {
+		return err
+	}
+	fmt.Printf("%s:%d\n", edit.Filename, edit.Line)
+	return nil
+}
+
+type WhatifCmd struct {
+	Path      string   `arg:""`
+	FieldPath string   `arg:"" default:"$" help:"jsonnet field path or object address, example, $.a.b or apps/v1/Deployment/ns/foo:.spec.replicas"`
+	Override  []string `short:"o" required:"" help:"file:line=expr or $.field.path=expr, example, 'config.libsonnet:5=\"4\"'"`
+}
+
+func (cmd *WhatifCmd) Run(cli *Context) error {
+	vm, err := cli.makeVM()
+	if err != nil {
+		return err
+	}
+	if cmd.FieldPath, err = ursonnet.ResolveAddress(vm, cmd.Path, cmd.FieldPath); err != nil {
+		return err
+	}
+
+	var overrides []ursonnet.Override
+	for _, s := range cmd.Override {
+		o, err := ursonnet.ParseOverride(s)
+		if err != nil {
+			return err
+		}
+		overrides = append(overrides, o)
+	}
+	res, err := ursonnet.WhatIf(vm, cmd.Path, cmd.FieldPath, overrides)
+	if err != nil {
+		return err
+	}
+	redactor, err := cli.redactor(cmd.Path)
+	if err != nil {
+		return err
+	}
+	res.Before, res.After = redactor.Value(cmd.FieldPath, res.Before), redactor.Value(cmd.FieldPath, res.After)
+	for i, c := range res.Changes {
+		res.Changes[i].Before, res.Changes[i].After = redactor.Value(c.Path, c.Before), redactor.Value(c.Path, c.After)
+	}
+	if res.Before == res.After {
+		fmt.Printf("%s: %s (unchanged)\n", cmd.FieldPath, res.Before)
+	} else {
+		fmt.Printf("%s: %s -> %s\n", cmd.FieldPath, res.Before, res.After)
+	}
+	if len(res.Changes) > 0 {
+		fmt.Println("changed output fields:")
+	}
+	for _, c := range res.Changes {
+		fmt.Printf("  %s: %s -> %s\n", c.Path, orAbsent(c.Before), orAbsent(c.After))
+	}
+	return nil
+}
+
+type SliceCmd struct {
 	Path      string `arg:""`
-	FieldPath string `arg:"" default:"$" help:"jsonnet field path, example, $.a.b"`
-	Debug     bool   `short:"d"`
+	FieldPath string `arg:"" help:"jsonnet field path or object address, example, $.a.b or apps/v1/Deployment/ns/foo:.spec.replicas"`
+	Output    string `short:"o" help:"Write the program to this file instead of stdout."`
+}
+
+func (cmd *SliceCmd) Run(cli *Context) error {
+	vm, err := cli.makeVM()
+	if err != nil {
+		return err
+	}
+	if cmd.FieldPath, err = ursonnet.ResolveAddress(vm, cmd.Path, cmd.FieldPath); err != nil {
+		return err
+	}
+
+	res, err := ursonnet.Slice(vm, cmd.Path, cmd.FieldPath)
+	if err != nil {
+		return err
+	}
+	if cmd.Output != "" {
+		return os.WriteFile(cmd.Output, []byte(res), 0o644)
+	}
+	fmt.Print(res)
+	return nil
+}
+
+type RunCmd struct {
+	Path     string   `arg:""`
+	Logpoint []string `short:"l" help:"file:line=expr, printed every time the field at file:line is evaluated, example, 'common.libsonnet:23=self.requests'"`
+}
+
+func (cmd *RunCmd) Run(cli *Context) error {
+	vm, err := cli.makeVM()
+	if err != nil {
+		return err
+	}
+
+	var logpoints []ursonnet.Logpoint
+	for _, s := range cmd.Logpoint {
+		l, err := ursonnet.ParseLogpoint(s)
+		if err != nil {
+			return err
+		}
+		logpoints = append(logpoints, l)
+	}
+	res, err := ursonnet.EvaluateWithLogpoints(vm, cmd.Path, logpoints)
+	if err != nil {
+		return err
+	}
+	fmt.Print(res)
+	return nil
+}
+
+type LspCmd struct {
+	Entrypoint string `help:"jsonnet file to evaluate; defaults to the initializationOptions entrypoint, or else to the file being edited."`
+}
+
+func (cmd *LspCmd) Run(cli *Context) error {
+	if len(cli.Secret) > 0 {
+		return errors.New("lsp doesn't support --secret: hover values aren't redacted")
+	}
+	newVM, err := cli.vmFactory()
+	if err != nil {
+		return err
+	}
+	s := &lsp.Server{Entrypoint: cmd.Entrypoint, NewVM: newVM}
+	return s.Serve(os.Stdin, os.Stdout)
+}
+
+type DapCmd struct{}
+
+func (cmd *DapCmd) Run(cli *Context) error {
+	if len(cli.Secret) > 0 {
+		return errors.New("dap doesn't support --secret: variable values aren't redacted")
+	}
+	newVM, err := cli.vmFactory()
+	if err != nil {
+		return err
+	}
+	s := &dap.Server{NewVM: newVM}
+	return s.Serve(os.Stdin, os.Stdout)
+}
+
+type ExploreCmd struct {
+	Path string `arg:""`
+}
+
+func (cmd *ExploreCmd) Run(cli *Context) error {
+	newVM, err := cli.vmFactory()
+	if err != nil {
+		return err
+	}
+	e := &tui.Explorer{Filename: cmd.Path, NewVM: newVM, Secrets: cli.Secret}
+	return e.Run()
+}
+
+type ServeCmd struct {
+	Listen string `default:"localhost:8484" help:"Address to listen on."`
+}
+
+func (cmd *ServeCmd) Run(cli *Context) error {
+	newVM, err := cli.vmFactory()
+	if err != nil {
+		return err
+	}
+	s := &server.Server{NewVM: newVM, Secrets: cli.Secret}
+	log.Printf("listening on http://%s", cmd.Listen)
+	return http.ListenAndServe(cmd.Listen, s.Handler())
+}
+
+type HTMLCmd struct {
+	Path   string `arg:""`
+	Output string `short:"o" help:"Write the page to this file instead of stdout."`
+}
+
+func (cmd *HTMLCmd) Run(cli *Context) error {
+	newVM, err := cli.vmFactory()
+	if err != nil {
+		return err
+	}
+	cache := ursonnet.NewCache(newVM)
+
+	output, err := cache.Evaluate(cmd.Path, "$")
+	if err != nil {
+		return err
+	}
+	roots, err := cache.Blame(cmd.Path)
+	if err != nil {
+		return err
+	}
+	redactor, err := ursonnet.NewRedactor(cache, cmd.Path, cli.Secret)
+	if err != nil {
+		return err
+	}
+	w := os.Stdout
+	if cmd.Output != "" {
+		if w, err = os.Create(cmd.Output); err != nil {
+			return err
+		}
+		defer w.Close()
+	}
+	return htmlreport.Write(w, htmlreport.Report{Entrypoint: cmd.Path, Output: output, Roots: roots, Redactor: redactor})
+}
+
+type DriftCmd struct {
+	Path string `arg:""`
+	Live string `arg:"" help:"YAML file with the live objects, example, saved from kubectl get -o yaml; - for stdin."`
+}
+
+func (cmd *DriftCmd) Run(cli *Context) error {
+	newVM, err := cli.vmFactory()
+	if err != nil {
+		return err
+	}
+	cache := ursonnet.NewCache(newVM)
+
+	r := os.Stdin
+	if cmd.Live != "-" {
+		if r, err = os.Open(cmd.Live); err != nil {
+			return err
+		}
+		defer r.Close()
+	}
+	live, err := ursonnet.LiveObjects(r)
+	if err != nil {
+		return fmt.Errorf("%s: %w", cmd.Live, err)
+	}
+	output, err := cache.Evaluate(cmd.Path, "$")
+	if err != nil {
+		return err
+	}
+	drifts, unmatched, err := ursonnet.Drifts(output, live)
+	if err != nil {
+		return err
+	}
+	for _, o := range unmatched {
+		fmt.Printf("%s: not in the output of %s\n", o.Address(), cmd.Path)
+	}
+	if len(drifts) == 0 {
+		fmt.Println("no drift")
+		return nil
+	}
+	redactor, err := ursonnet.NewRedactor(cache, cmd.Path, cli.Secret)
+	if err != nil {
+		return err
+	}
+	for _, d := range drifts {
+		live, intended := orAbsent(redactor.Value(d.Path, d.Live)), redactor.Value(d.Path, d.Intended)
+		fmt.Printf("%s:%s: live %s, intended %s%s\n", d.Object, d.Field, live, intended, secretFlag(redactor, d.Path))
+		roots, err := cache.Roots(cmd.Path, d.Path)
+		if err != nil {
+			return err
+		}
+		for _, root := range roots {
+			fmt.Printf("  %s\n", strings.TrimSpace(root))
+		}
+	}
+	return nil
+}
+
+type RenderCmd struct {
+	Path    string `arg:""`
+	Sources bool   `help:"Annotate each object with ursonnet.kubecfg.io/sources, the deduplicated source lines (relative to the repository root) that produced its values."`
+	Output  string `short:"o" help:"Write the YAML to this file instead of stdout."`
+}
+
+func (cmd *RenderCmd) Run(cli *Context) error {
+	newVM, err := cli.vmFactory()
+	if err != nil {
+		return err
+	}
+	cache := ursonnet.NewCache(newVM)
+
+	output, err := cache.Evaluate(cmd.Path, "$")
+	if err != nil {
+		return err
+	}
+	redactor, err := ursonnet.NewRedactor(cache, cmd.Path, cli.Secret)
+	if err != nil {
+		return err
+	}
+	output = redactor.Output(output)
+	if cmd.Sources {
+		blame, err := cache.Blame(cmd.Path)
+		if err != nil {
+			return err
+		}
+		sources := map[string][]string{}
+		for path, roots := range blame {
+			for _, root := range roots {
+				if file, line, err := ursonnet.ParseRoot(root); err == nil {
+					sources[path] = append(sources[path], fmt.Sprintf("%s:%d", repoPath(file), line))
+				}
+			}
+		}
+		if output, err = ursonnet.AnnotateSources(output, sources); err != nil {
+			return err
+		}
+	}
+	res, err := ursonnet.RenderYAML(output)
+	if err != nil {
+		return err
+	}
+	if cmd.Output != "" {
+		return os.WriteFile(cmd.Output, []byte(res), 0o644)
+	}
+	fmt.Print(res)
+	return nil
+}
+
+type ProvenanceCmd struct {
+	Path   string `arg:""`
+	Output string `short:"o" help:"Write the statement to this file instead of stdout."`
+}
+
+func (cmd *ProvenanceCmd) Run(cli *Context) error {
+	newVM, err := cli.vmFactory()
+	if err != nil {
+		return err
+	}
+	params, err := cli.parameters(cmd.Path)
+	if err != nil {
+		return err
+	}
+	st, err := ursonnet.NewStatement(ursonnet.NewCache(newVM), params)
+	if err != nil {
+		return err
+	}
+	w := os.Stdout
+	if cmd.Output != "" {
+		if w, err = os.Create(cmd.Output); err != nil {
+			return err
+		}
+		defer w.Close()
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	e.SetEscapeHTML(false)
+	return e.Encode(st)
+}
+
+type ReportCmd struct {
+	Report string `arg:"" enum:"images,resources,replicas,namespaces" help:"Fields to report: images, resources, replicas or namespaces."`
+	Path   string `arg:""`
+	Format string `enum:"table,markdown,json" default:"table" help:"Output format: table, markdown or json."`
+}
+
+func (cmd *ReportCmd) Run(cli *Context) error {
+	newVM, err := cli.vmFactory()
+	if err != nil {
+		return err
+	}
+	cache := ursonnet.NewCache(newVM)
+
+	output, err := cache.Evaluate(cmd.Path, "$")
+	if err != nil {
+		return err
+	}
+	fields, err := ursonnet.ReportFields(output, ursonnet.Report(cmd.Report))
+	if err != nil {
+		return err
+	}
+	redactor, err := ursonnet.NewRedactor(cache, cmd.Path, cli.Secret)
+	if err != nil {
+		return err
+	}
+	var results []fieldRoots
+	for _, f := range fields {
+		roots, err := cache.Roots(cmd.Path, f.Path)
+		if err != nil {
+			return err
+		}
+		results = append(results, fieldRoots{Path: f.Object + ":" + f.Field, Value: redactor.Value(f.Path, f.Value), Secret: redactor.Secret(f.Path), Roots: roots})
+	}
+
+	switch cmd.Format {
+	case "markdown":
+		writeMarkdown(os.Stdout, cmd.Path, results, false, "")
+	case "json":
+		return writeJSON(os.Stdout, cmd.Path, results)
+	default:
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "OBJECT\tFIELD\tVALUE\tROOTS")
+		for i, r := range results {
+			var roots []string
+			for _, root := range r.Roots {
+				roots = append(roots, strings.TrimSpace(root))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s%s\t%s\n", fields[i].Object, fields[i].Field, r.Value, secretFlag(redactor, fields[i].Path), strings.Join(roots, " "))
+		}
+		return w.Flush()
+	}
+	return nil
 }
 
-func (cmd *CLI) Run(cli *Context) error {
-	vm := jsonnet.MakeVM()
+type InputsCmd struct {
+	Path   string `arg:""`
+	Format string `enum:"table,json" default:"table" help:"Output format: table or json."`
+}
+
+// maxAffects is the number of affected paths shown per input in tables.
+const maxAffects = 3
 
-	res, err := ursonnet.Roots(vm, cli.Path, cli.FieldPath, ursonnet.Debug(cmd.Debug))
+func (cmd *InputsCmd) Run(cli *Context) error {
+	newVM, err := cli.vmFactory()
+	if err != nil {
+		return err
+	}
+	inputs, err := ursonnet.Inputs(ursonnet.NewCache(newVM), cmd.Path)
 	if err != nil {
 		return err
 	}
-	for _, i := range res {
-		fmt.Println(i)
+	if cmd.Format == "json" {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		e.SetEscapeHTML(false)
+		return e.Encode(struct {
+			SchemaVersion int              `json:"schemaVersion"`
+			Entrypoint    string           `json:"entrypoint"`
+			Inputs        []ursonnet.Input `json:"inputs"`
+		}{schemaVersion, cmd.Path, append([]ursonnet.Input{}, inputs...)})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAME\tVALUE\tSOURCE\tAFFECTS")
+	for _, in := range inputs {
+		affects := in.Affects
+		if len(affects) > maxAffects {
+			affects = append(affects[:maxAffects:maxAffects], fmt.Sprintf("+%d more", len(in.Affects)-maxAffects))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", in.Kind, in.Name, oneLine(in.Value), strings.Join(in.Sources, " "), strings.Join(affects, " "))
+	}
+	return w.Flush()
+}
+
+type InfluenceCmd struct {
+	Path   string `arg:""`
+	Format string `enum:"table,json" default:"table" help:"Output format: table or json."`
+}
+
+func (cmd *InfluenceCmd) Run(cli *Context) error {
+	newVM, err := cli.vmFactory()
+	if err != nil {
+		return err
+	}
+	influence, err := ursonnet.Influence(ursonnet.NewCache(newVM), cmd.Path, cli.Secret)
+	if err != nil {
+		return err
+	}
+	type leaf struct {
+		Path    string            `json:"path"`
+		Secret  bool              `json:"secret,omitempty"`
+		Sources []ursonnet.Source `json:"sources"`
+	}
+	leaves := []leaf{}
+	for p, sources := range influence {
+		l := leaf{Path: p, Sources: sources}
+		for _, s := range sources {
+			l.Secret = l.Secret || s.Secret
+		}
+		leaves = append(leaves, l)
+	}
+	sort.Slice(leaves, func(i, j int) bool { return leaves[i].Path < leaves[j].Path })
+	if cmd.Format == "json" {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		e.SetEscapeHTML(false)
+		return e.Encode(struct {
+			SchemaVersion int    `json:"schemaVersion"`
+			Entrypoint    string `json:"entrypoint"`
+			Leaves        []leaf `json:"leaves"`
+		}{schemaVersion, cmd.Path, leaves})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PATH\tSOURCES")
+	for _, l := range leaves {
+		var sources []string
+		for _, s := range l.Sources {
+			source := s.Kind.String() + " " + s.Name
+			if s.Secret {
+				source += " (secret)"
+			}
+			sources = append(sources, source)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", l.Path, strings.Join(sources, ", "))
+	}
+	return w.Flush()
+}
+
+type AtCmd struct {
+	Path     string `arg:""`
+	Location string `arg:"" optional:"" help:"FILE:LINE of a YAML file with objects of the output, example, rendered.yaml:142, or LINE of the YAML rendered like kubecfg show does, which is printed if omitted."`
+}
+
+func (cmd *AtCmd) Run(cli *Context) error {
+	vm, err := cli.makeVM()
+	if err != nil {
+		return err
+	}
+	output, err := ursonnet.Evaluate(vm, cmd.Path, "$")
+	if err != nil {
+		return err
+	}
+	redactor, err := cli.redactor(cmd.Path)
+	if err != nil {
+		return err
+	}
+
+	file, line := "", cmd.Location
+	if i := strings.LastIndexByte(cmd.Location, ':'); i >= 0 {
+		file, line = cmd.Location[:i], cmd.Location[i+1:]
+	}
+	var content string
+	if file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		content = string(b)
+	} else if content, err = ursonnet.RenderYAML(redactor.Output(output)); err != nil {
+		return err
+	}
+	if cmd.Location == "" {
+		fmt.Print(content)
+		return nil
+	}
+	n, err := strconv.Atoi(line)
+	if err != nil {
+		return fmt.Errorf("bad line number in %q", cmd.Location)
+	}
+
+	at, err := ursonnet.LocateYAMLLine(content, n)
+	if err != nil {
+		return err
+	}
+	address := at.Object.Address() + ":" + at.Field
+	path, err := ursonnet.AddressFieldPath(output, address)
+	if err != nil && at.Object.Namespace != "" {
+		// the namespace may have been set by the cluster, like drift assumes
+		o := at.Object
+		o.Namespace = ""
+		if p, err2 := ursonnet.AddressFieldPath(output, o.Address()+":"+at.Field); err2 == nil {
+			path, err = p, nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if ok, err := ursonnet.HasField(output, path); err != nil {
+		return err
+	} else if !ok {
+		// e.g. a field added by the cluster
+		return fmt.Errorf("%s: not produced by %s", strings.TrimSuffix(address, ":"), cmd.Path)
+	}
+	roots, err := ursonnet.Roots(vm, cmd.Path, path, ursonnet.Debug(cli.Debug))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s (%s)%s\n", strings.TrimSuffix(address, ":"), path, secretFlag(redactor, path))
+	for _, root := range roots {
+		fmt.Printf("  %s\n", strings.TrimSpace(root))
 	}
 	return nil
 }
 
+// secretFlag flags the values influenced by secrets.
+func secretFlag(r *ursonnet.Redactor, path string) string {
+	if r.Secret(path) {
+		return " (secret)"
+	}
+	return ""
+}
+
+func orAbsent(v string) string {
+	if v == "" {
+		return "<absent>"
+	}
+	return v
+}
+
 func main() {
 	var cli CLI
 	ctx := kong.Parse(&cli)
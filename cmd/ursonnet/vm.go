@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/kubecfg/ursonnet"
+)
+
+// VMFlags configure the jsonnet VM like the flags of the jsonnet command do.
+type VMFlags struct {
+	JPath       []string `short:"J" name:"jpath" placeholder:"DIR" help:"Additional library search dir, taking precedence over JSONNET_PATH and earlier dirs."`
+	ExtStr      []string `short:"V" name:"ext-str" placeholder:"VAR[=VAL]" sep:"none" help:"External string variable; if VAL is omitted, it's taken from the environment."`
+	ExtStrFile  []string `name:"ext-str-file" placeholder:"VAR=FILE" sep:"none" help:"External string variable read from a file."`
+	ExtCode     []string `name:"ext-code" placeholder:"VAR[=CODE]" sep:"none" help:"External code variable; if CODE is omitted, it's taken from the environment."`
+	ExtCodeFile []string `name:"ext-code-file" placeholder:"VAR=FILE" sep:"none" help:"External code variable read from a file."`
+	TLAStr      []string `short:"A" name:"tla-str" placeholder:"VAR[=VAL]" sep:"none" help:"Top-level string argument; if VAL is omitted, it's taken from the environment."`
+	TLAStrFile  []string `name:"tla-str-file" placeholder:"VAR=FILE" sep:"none" help:"Top-level string argument read from a file."`
+	TLACode     []string `name:"tla-code" placeholder:"VAR[=CODE]" sep:"none" help:"Top-level code argument; if CODE is omitted, it's taken from the environment."`
+	TLACodeFile []string `name:"tla-code-file" placeholder:"VAR=FILE" sep:"none" help:"Top-level code argument read from a file."`
+	Secret      []string `name:"secret" placeholder:"VAR" help:"Ext var or top-level argument whose value is secret: the output values it influences are redacted from reports and flagged. Not supported by lsp and dap."`
+}
+
+// jpaths returns the library search dirs in the order the importer wants them, last one first:
+// the JSONNET_PATH dirs, left-most last, then the -J dirs.
+func (f *VMFlags) jpaths() []string {
+	var res []string
+	env := filepath.SplitList(os.Getenv("JSONNET_PATH"))
+	for i := len(env) - 1; i >= 0; i-- {
+		res = append(res, env[i])
+	}
+	return append(res, f.JPath...)
+}
+
+// flagVar is an ext var or top-level argument set by a flag.
+type flagVar struct {
+	name  string
+	value string
+	tla   bool
+	code  bool
+	// file is the file read by the *-file flags; value is its content.
+	file string
+}
+
+// vars checks and returns the ext vars and top-level arguments set by the flags.
+func (f *VMFlags) vars() ([]flagVar, error) {
+	var res []flagVar
+	for _, v := range []struct {
+		flags []string
+		file  bool
+		tla   bool
+		code  bool
+	}{
+		{f.ExtStr, false, false, false},
+		{f.ExtStrFile, true, false, false},
+		{f.ExtCode, false, false, true},
+		{f.ExtCodeFile, true, false, true},
+		{f.TLAStr, false, true, false},
+		{f.TLAStrFile, true, true, false},
+		{f.TLACode, false, true, true},
+		{f.TLACodeFile, true, true, true},
+	} {
+		for _, s := range v.flags {
+			name, value, err := varValue(s, v.file)
+			if err != nil {
+				return nil, err
+			}
+			fv := flagVar{name: name, value: value, tla: v.tla, code: v.code}
+			if v.file {
+				b, err := os.ReadFile(value)
+				if err != nil {
+					return nil, err
+				}
+				fv.file, fv.value = value, string(b)
+			}
+			res = append(res, fv)
+		}
+	}
+	return res, nil
+}
+
+// vmFactory checks the flags and returns a function making VMs configured by them.
+func (f *VMFlags) vmFactory() (func() *jsonnet.VM, error) {
+	vars, err := f.vars()
+	if err != nil {
+		return nil, err
+	}
+	jpaths := f.jpaths()
+	return func() *jsonnet.VM {
+		vm := jsonnet.MakeVM()
+		vm.Importer(&jsonnet.FileImporter{JPaths: jpaths})
+		for _, v := range vars {
+			value := v.value
+			if v.code && v.file != "" {
+				// imported rather than evaluated as a snippet, so that its own imports are relative to it
+				value = fmt.Sprintf("import @'%s'", strings.ReplaceAll(v.file, "'", "''"))
+			}
+			switch {
+			case v.tla && v.code:
+				vm.TLACode(v.name, value)
+			case v.tla:
+				vm.TLAVar(v.name, value)
+			case v.code:
+				vm.ExtCode(v.name, value)
+			default:
+				vm.ExtVar(v.name, value)
+			}
+		}
+		return vm
+	}, nil
+}
+
+// parameters returns the provenance parameters of an evaluation of filename with the flags.
+func (f *VMFlags) parameters(filename string) (ursonnet.Parameters, error) {
+	res := ursonnet.Parameters{Entrypoint: filename}
+	vars, err := f.vars()
+	if err != nil {
+		return res, err
+	}
+	for _, v := range vars {
+		m := &res.ExtVars
+		if v.tla {
+			m = &res.TLAs
+		}
+		if *m == nil {
+			*m = map[string]ursonnet.Var{}
+		}
+		value := v.value
+		if f.secret(v.name) {
+			value = ursonnet.Redacted
+		}
+		(*m)[v.name] = ursonnet.Var{Code: v.code, Value: value, File: v.file}
+		if v.file != "" {
+			res.Files = append(res.Files, v.file)
+		}
+	}
+	return res, nil
+}
+
+// secret reports whether the ext var or top-level argument name is marked as secret.
+func (f *VMFlags) secret(name string) bool {
+	for _, s := range f.Secret {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// redactor returns the Redactor of the output of filename for the secrets of the flags, nil without secrets.
+func (f *VMFlags) redactor(filename string) (*ursonnet.Redactor, error) {
+	if len(f.Secret) == 0 {
+		return nil, nil
+	}
+	newVM, err := f.vmFactory()
+	if err != nil {
+		return nil, err
+	}
+	return ursonnet.NewRedactor(ursonnet.NewCache(newVM), filename, f.Secret)
+}
+
+// makeVM returns a VM configured by the flags.
+func (f *VMFlags) makeVM() (*jsonnet.VM, error) {
+	newVM, err := f.vmFactory()
+	if err != nil {
+		return nil, err
+	}
+	return newVM(), nil
+}
+
+// varValue parses a VAR=VAL flag. For the *-file flags, VAL is a file; otherwise it defaults to the environment
+// variable VAR.
+func varValue(s string, file bool) (string, string, error) {
+	parts := strings.SplitN(s, "=", 2)
+	name := parts[0]
+	if file {
+		if len(parts) == 1 {
+			return "", "", fmt.Errorf("%q must be written as VAR=FILE", s)
+		}
+		return name, parts[1], nil
+	}
+	if len(parts) == 1 {
+		val, ok := os.LookupEnv(name)
+		if !ok {
+			return "", "", fmt.Errorf("environment variable %s is undefined", name)
+		}
+		return name, val, nil
+	}
+	return name, parts[1], nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kubecfg/ursonnet"
+)
+
+func TestParameters(t *testing.T) {
+	dir := t.TempDir()
+	pw := filepath.Join(dir, "pw.txt")
+	conf := filepath.Join(dir, "conf.jsonnet")
+	entrypoint := filepath.Join(dir, "main.jsonnet")
+	for name, content := range map[string]string{
+		pw:         "hunter2",
+		conf:       "{ replicas: 3 }",
+		entrypoint: "function(env) { env: env, pw: std.extVar('pw'), conf: std.extVar('conf'), user: std.extVar('user') }",
+	} {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	flags := VMFlags{
+		ExtStr:      []string{"user=admin"},
+		ExtStrFile:  []string{"pw=" + pw},
+		ExtCodeFile: []string{"conf=" + conf},
+		TLAStr:      []string{"env=prod"},
+		Secret:      []string{"pw"},
+	}
+
+	params, err := flags.parameters(entrypoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ursonnet.Parameters{
+		Entrypoint: entrypoint,
+		ExtVars: map[string]ursonnet.Var{
+			"user": {Value: "admin"},
+			"pw":   {Value: ursonnet.Redacted, File: pw},
+			"conf": {Code: true, Value: "{ replicas: 3 }", File: conf},
+		},
+		TLAs:  map[string]ursonnet.Var{"env": {Value: "prod"}},
+		Files: []string{pw, conf},
+	}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("parameters = %+v, want %+v", params, want)
+	}
+
+	vm, err := flags.makeVM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ursonnet.Evaluate(vm, entrypoint, "$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"conf":{"replicas":3},"env":"prod","pw":"hunter2","user":"admin"}`; compact(t, got) != want {
+		t.Errorf("output = %s, want %s", got, want)
+	}
+}
+
+func TestVarValue(t *testing.T) {
+	t.Setenv("URSONNET_TEST_VAR", "from env")
+	tests := []struct {
+		s     string
+		file  bool
+		name  string
+		value string
+	}{
+		{"a=b", false, "a", "b"},
+		{"a=b=c", false, "a", "b=c"},
+		{"a=", false, "a", ""},
+		{"URSONNET_TEST_VAR", false, "URSONNET_TEST_VAR", "from env"},
+		{"a=dir/f.txt", true, "a", "dir/f.txt"},
+	}
+	for _, test := range tests {
+		name, value, err := varValue(test.s, test.file)
+		if err != nil || name != test.name || value != test.value {
+			t.Errorf("varValue(%q, %v) = %q, %q, %v", test.s, test.file, name, value, err)
+		}
+	}
+	if _, _, err := varValue("URSONNET_TEST_UNDEFINED", false); err == nil {
+		t.Error("varValue of an undefined environment variable succeeded")
+	}
+	if _, _, err := varValue("a", true); err == nil {
+		t.Error("varValue of a file flag without a file succeeded")
+	}
+}
+
+func compact(t *testing.T, s string) string {
+	t.Helper()
+	var b bytes.Buffer
+	if err := json.Compact(&b, []byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
@@ -0,0 +1,247 @@
+package ursonnet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"gopkg.in/yaml.v3"
+)
+
+// dataImport returns the AST of the value of a call parsing an imported data file, like
+//
+//	std.parseYaml(importstr "values.yaml")
+//	std.parseJson(importstr "values.json")
+//
+// made of literals located in the data file: the fields are located at their keys, so that the roots of the values
+// they hold point at the lines of the data file. The value is decoded like the std functions do.
+// If patch is not nil it's applied to the content of the data file, like expandImports does.
+// It returns false for other calls, and for data that doesn't parse, whose error is left to the evaluation.
+func dataImport(vm *jsonnet.VM, a ast.Node, patch patchFunc) (ast.Node, bool, error) {
+	call, ok := a.(*ast.Apply)
+	if !ok {
+		return nil, false, nil
+	}
+	fn, ok := stdCall(call)
+	if !ok || (fn != "parseYaml" && fn != "parseJson") || len(call.Arguments.Positional) != 1 || len(call.Arguments.Named) != 0 {
+		return nil, false, nil
+	}
+	imp, ok := call.Arguments.Positional[0].Expr.(*ast.ImportStr)
+	if !ok {
+		return nil, false, nil
+	}
+	content, foundAt, err := vm.ImportData(imp.Loc().FileName, imp.File.Value)
+	if err != nil {
+		return nil, false, err
+	}
+	if patch != nil {
+		patched, err := patch(foundAt, content)
+		if err != nil {
+			return nil, false, err
+		}
+		if patched != content {
+			res, ok := parseData(fn, foundAt, patched)
+			if !ok {
+				return nil, false, fmt.Errorf("%s: the patched data doesn't parse", foundAt)
+			}
+			return res, true, nil
+		}
+	}
+	res, ok := parseData(fn, foundAt, content)
+	return res, ok, nil
+}
+
+// parseData returns the AST of the value parsed from content, the content of the data file filename,
+// by the std function fn, parseYaml or parseJson. It returns false if the data doesn't parse.
+func parseData(fn, filename, content string) (ast.Node, bool) {
+	var v interface{}
+	var docs []*yaml.Node
+	d := yaml.NewDecoder(strings.NewReader(content))
+	for {
+		var n yaml.Node
+		if err := d.Decode(&n); err != nil {
+			// the lines are only used if the documents match the decoded ones
+			break
+		}
+		docs = append(docs, &n)
+	}
+	var n *yaml.Node
+	if fn == "parseJson" {
+		if err := json.Unmarshal([]byte(content), &v); err != nil {
+			return nil, false
+		}
+		if len(docs) == 1 {
+			n = docs[0]
+		}
+	} else {
+		elems, err := decodeYAMLStream(content)
+		if err != nil || len(elems) == 0 {
+			return nil, false
+		}
+		// like std.parseYaml, which returns an array for streams
+		if strings.Contains(content, "---") {
+			v = elems
+			if len(docs) == len(elems) {
+				n = &yaml.Node{Kind: yaml.SequenceNode, Content: docs}
+			}
+		} else {
+			v = elems[0]
+			if len(docs) > 0 {
+				n = docs[0]
+			}
+		}
+	}
+	// without lines, everything is located at the top of the file
+	top := ast.Location{Line: 1, Column: 1}
+	loc := ast.LocationRange{FileName: filename, File: ast.BuildSource(ast.DiagnosticFileName(filename), content), Begin: top, End: top}
+	return dataAST(v, n, loc), true
+}
+
+// stdCall returns the name of the std function called by call, if it calls one.
+func stdCall(call *ast.Apply) (string, bool) {
+	index, ok := call.Target.(*ast.Index)
+	if !ok {
+		return "", false
+	}
+	if std, ok := index.Target.(*ast.Var); !ok || std.Id != "std" {
+		return "", false
+	}
+	fn, ok := index.Index.(*ast.LiteralString)
+	if !ok {
+		return "", false
+	}
+	return fn.Value, true
+}
+
+// decodeYAMLStream decodes the documents of a YAML stream into JSON values, like std.parseYaml does.
+func decodeYAMLStream(content string) ([]interface{}, error) {
+	var res []interface{}
+	d := jsonnet.NewYAMLToJSONDecoder(strings.NewReader(content))
+	for {
+		var v interface{}
+		if err := d.Decode(&v); err == io.EOF {
+			return res, nil
+		} else if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+}
+
+// dataAST returns the AST of a decoded JSON value, located by the YAML node n it was decoded from, if known,
+// or else at loc.
+func dataAST(v interface{}, n *yaml.Node, loc ast.LocationRange) ast.Node {
+	for n != nil && (n.Kind == yaml.DocumentNode || n.Kind == yaml.AliasNode) {
+		if n.Kind == yaml.AliasNode {
+			n = n.Alias
+		} else if len(n.Content) > 0 {
+			n = n.Content[0]
+		} else {
+			n = nil
+		}
+	}
+	if n != nil {
+		loc = yamlLoc(loc, n)
+	}
+	base := ast.NodeBase{LocRange: loc}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		o := &ast.DesugaredObject{NodeBase: base}
+		for _, k := range sortedFields(v) {
+			key, value := mappingEntry(n, k)
+			floc := loc
+			if key != nil {
+				floc = yamlLoc(loc, key)
+			}
+			o.Fields = append(o.Fields, ast.DesugaredObjectField{
+				Name:     &ast.LiteralString{NodeBase: ast.NodeBase{LocRange: floc}, Value: k, Kind: ast.StringDouble},
+				Body:     dataAST(v[k], value, floc),
+				LocRange: floc,
+				Hide:     ast.ObjectFieldInherit,
+			})
+		}
+		return o
+	case []interface{}:
+		arr := &ast.Array{NodeBase: base}
+		for i, e := range v {
+			var en *yaml.Node
+			if n != nil && n.Kind == yaml.SequenceNode && i < len(n.Content) {
+				en = n.Content[i]
+			}
+			arr.Elements = append(arr.Elements, ast.CommaSeparatedExpr{Expr: dataAST(e, en, loc)})
+		}
+		return arr
+	case string:
+		return &ast.LiteralString{NodeBase: base, Value: v, Kind: ast.StringDouble}
+	case float64:
+		return &ast.LiteralNumber{NodeBase: base, OriginalString: strconv.FormatFloat(v, 'g', -1, 64)}
+	case bool:
+		return &ast.LiteralBoolean{NodeBase: base, Value: v}
+	default:
+		return &ast.LiteralNull{NodeBase: base}
+	}
+}
+
+// mappingEntry returns the key and value nodes of the field k of the YAML mapping n, if found.
+// Fields brought by merge keys aren't found.
+func mappingEntry(n *yaml.Node, k string) (*yaml.Node, *yaml.Node) {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == k {
+			return n.Content[i], n.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// yamlLoc returns the location of the YAML node n in the file of loc.
+// Scalars on a single line end where their text does, so that they can be spliced like jsonnet literals.
+func yamlLoc(loc ast.LocationRange, n *yaml.Node) ast.LocationRange {
+	begin := ast.Location{Line: n.Line, Column: n.Column}
+	end := begin
+	if n.Kind == yaml.ScalarNode && n.Line <= len(loc.File.Lines) {
+		line := []rune(loc.File.Lines[n.Line-1])
+		if n.Column-1 < len(line) {
+			end.Column += scalarWidth(line[n.Column-1:], n)
+		}
+	}
+	return ast.LocationRange{FileName: loc.FileName, File: loc.File, Begin: begin, End: end}
+}
+
+// scalarWidth returns the number of runes of the scalar n written at the start of text, or 0 if it spans lines.
+func scalarWidth(text []rune, n *yaml.Node) int {
+	switch n.Style {
+	case 0:
+		// plain scalars spanning lines are folded into a single line value
+		if w := len([]rune(n.Value)); w <= len(text) && string(text[:w]) == n.Value {
+			return w
+		}
+	case yaml.DoubleQuotedStyle:
+		for i := 1; i < len(text); i++ {
+			switch text[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1
+			}
+		}
+	case yaml.SingleQuotedStyle:
+		for i := 1; i < len(text); i++ {
+			if text[i] == '\'' {
+				if i+1 < len(text) && text[i+1] == '\'' {
+					i++
+					continue
+				}
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+package ursonnet
+
+import (
+	"testing"
+
+	"github.com/google/go-jsonnet/ast"
+)
+
+func TestParseData(t *testing.T) {
+	const values = `# values
+image: foo:1  # the image
+name: "a \"b\" c"
+quote: 'it''s'
+replicas: 3
+labels: {app: foo, tier: web}
+args:
+- --a
+- |
+  multi
+  line
+folded: foo
+  bar
+`
+	tests := []struct {
+		fn, content string
+		path        string
+		// the location of the value, begin line and column and end column
+		line, begin, end int
+	}{
+		{"parseYaml", values, "$.image", 2, 8, 13},
+		{"parseYaml", values, "$.name", 3, 7, 18},
+		{"parseYaml", values, "$.quote", 4, 8, 15},
+		{"parseYaml", values, "$.replicas", 5, 11, 12},
+		{"parseYaml", values, "$.labels", 6, 9, 9},
+		{"parseYaml", values, "$.labels.tier", 6, 26, 29},
+		{"parseYaml", values, "$.args[0]", 8, 3, 6},
+		// values spanning lines can't be spliced: they end where they begin
+		{"parseYaml", values, "$.args[1]", 9, 3, 3},
+		{"parseYaml", values, "$.folded", 12, 9, 9},
+		{"parseYaml", "a: 1\n---\nb: {c: true}\n", "$[1].b.c", 3, 8, 12},
+		{"parseJson", "{\n  \"a\": [1, \"b\"],\n  \"c\": null\n}\n", "$.a[1]", 2, 12, 15},
+		{"parseJson", "{\n  \"a\": [1, \"b\"],\n  \"c\": null\n}\n", "$.c", 3, 8, 12},
+	}
+	for _, test := range tests {
+		a, ok := parseData(test.fn, "values", test.content)
+		if !ok {
+			t.Errorf("%s: the data doesn't parse", test.path)
+			continue
+		}
+		n := dataNode(t, a, test.path)
+		if n == nil {
+			continue
+		}
+		loc := n.Loc()
+		if loc.Begin.Line != test.line || loc.Begin.Column != test.begin || loc.End.Line != test.line || loc.End.Column != test.end {
+			t.Errorf("%s is at %s, want %d:%d-%d", test.path, loc, test.line, test.begin, test.end)
+		}
+	}
+
+	for _, test := range []struct{ fn, content string }{
+		{"parseJson", "{"},
+		{"parseJson", "a: 1"},
+		{"parseYaml", "a: [1"},
+		{"parseYaml", ""},
+	} {
+		if _, ok := parseData(test.fn, "values", test.content); ok {
+			t.Errorf("%s(%q) parsed", test.fn, test.content)
+		}
+	}
+}
+
+// dataNode returns the node of the value at path in the AST returned by parseData.
+func dataNode(t *testing.T, a ast.Node, path string) ast.Node {
+	t.Helper()
+	p, err := parseFieldPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range p {
+		switch n := a.(type) {
+		case *ast.Array:
+			if !e.IsIndex || e.Index >= len(n.Elements) {
+				t.Errorf("%s: no element %d", path, e.Index)
+				return nil
+			}
+			a = n.Elements[e.Index].Expr
+		case *ast.DesugaredObject:
+			a = nil
+			for _, f := range n.Fields {
+				if name, ok := f.Name.(*ast.LiteralString); ok && name.Value == e.Field {
+					a = f.Body
+				}
+			}
+			if a == nil {
+				t.Errorf("%s: no field %s", path, e.Field)
+				return nil
+			}
+		default:
+			t.Errorf("%s: %T isn't an array nor an object", path, a)
+			return nil
+		}
+	}
+	return a
+}
@@ -0,0 +1,112 @@
+package ursonnet
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change is an output field whose value differs between two evaluations.
+type Change struct {
+	// Path is the field path of the changed value, like `$.a.b[0]`.
+	Path string
+	// Before and After are the JSON values; empty if the field is absent.
+	Before string
+	After  string
+}
+
+// Diff compares two JSON outputs, e.g. the output of an entrypoint before and after a change,
+// and returns the changed values like WhatIf does.
+func Diff(before, after string) ([]Change, error) {
+	return diffJSON(before, after)
+}
+
+// diffJSON compares two JSON documents and returns the changed leaves.
+// When a value changes type (or is added or removed), it's reported as a whole.
+func diffJSON(before, after string) ([]Change, error) {
+	a, err := decodeJSON(before)
+	if err != nil {
+		return nil, err
+	}
+	b, err := decodeJSON(after)
+	if err != nil {
+		return nil, err
+	}
+	var res []Change
+	diffValues(nil, a, b, true, true, &res)
+	return res, nil
+}
+
+func diffValues(path fieldPath, a, b interface{}, hasA, hasB bool, res *[]Change) {
+	if hasA && hasB {
+		switch a := a.(type) {
+		case map[string]interface{}:
+			if b, ok := b.(map[string]interface{}); ok {
+				keys := map[string]bool{}
+				for k := range a {
+					keys[k] = true
+				}
+				for k := range b {
+					keys[k] = true
+				}
+				var sorted []string
+				for k := range keys {
+					sorted = append(sorted, k)
+				}
+				sort.Strings(sorted)
+				for _, k := range sorted {
+					va, okA := a[k]
+					vb, okB := b[k]
+					diffValues(path.append(pathElem{Field: k}), va, vb, okA, okB, res)
+				}
+				return
+			}
+		case []interface{}:
+			if b, ok := b.([]interface{}); ok {
+				for i := 0; i < len(a) || i < len(b); i++ {
+					var va, vb interface{}
+					if i < len(a) {
+						va = a[i]
+					}
+					if i < len(b) {
+						vb = b[i]
+					}
+					diffValues(path.append(pathElem{Index: i, IsIndex: true}), va, vb, i < len(a), i < len(b), res)
+				}
+				return
+			}
+		}
+		if reflect.DeepEqual(a, b) {
+			return
+		}
+	}
+	c := Change{Path: path.String()}
+	if hasA {
+		c.Before = toJSON(a)
+	}
+	if hasB {
+		c.After = toJSON(b)
+	}
+	*res = append(*res, c)
+}
+
+// decodeJSON decodes a JSON document keeping numbers as they were written.
+func decodeJSON(s string) (interface{}, error) {
+	d := json.NewDecoder(strings.NewReader(s))
+	d.UseNumber()
+	var v interface{}
+	err := d.Decode(&v)
+	return v, err
+}
+
+// toJSON encodes v like jsonnet manifests values, without escaping HTML characters.
+func toJSON(v interface{}) string {
+	var b strings.Builder
+	e := json.NewEncoder(&b)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(v); err != nil {
+		panic(err) // v was decoded from JSON
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,80 @@
+package ursonnet
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		want          []Change
+	}{
+		{
+			name:   "same",
+			before: `{"a": [1, {"b": "c"}], "d": null}`,
+			after:  `{"d": null, "a": [1, {"b": "c"}]}`,
+		},
+		{
+			name:   "changed leaves",
+			before: `{"a": {"b": 1, "c": "x"}, "d": true}`,
+			after:  `{"a": {"b": 2, "c": "x"}, "d": false}`,
+			want: []Change{
+				{Path: "$.a.b", Before: "1", After: "2"},
+				{Path: "$.d", Before: "true", After: "false"},
+			},
+		},
+		{
+			name:   "added and removed fields",
+			before: `{"a": 1, "b-c": {"d": 2}}`,
+			after:  `{"a": 1, "e": [3]}`,
+			want: []Change{
+				{Path: `$["b-c"]`, Before: `{"d":2}`},
+				{Path: "$.e", After: "[3]"},
+			},
+		},
+		{
+			name:   "array lengths",
+			before: `[1, 2]`,
+			after:  `[1, 3, 4]`,
+			want: []Change{
+				{Path: "$[1]", Before: "2", After: "3"},
+				{Path: "$[2]", After: "4"},
+			},
+		},
+		{
+			name:   "changed type",
+			before: `{"a": {"b": 1}}`,
+			after:  `{"a": "<b>"}`,
+			want: []Change{
+				{Path: "$.a", Before: `{"b":1}`, After: `"<b>"`},
+			},
+		},
+		{
+			name:   "numbers as written",
+			before: `{"a": 12345678901234567890, "b": 1.0}`,
+			after:  `{"a": 12345678901234567891, "b": 1.0}`,
+			want: []Change{
+				{Path: "$.a", Before: "12345678901234567890", After: "12345678901234567891"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Diff(test.before, test.after)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Diff = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDiffErrors(t *testing.T) {
+	if _, err := Diff(`{`, `{}`); err == nil {
+		t.Error("Diff of bad JSON succeeded")
+	}
+}
@@ -0,0 +1,132 @@
+package ursonnet
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+)
+
+// Drift is a field of a live object whose value differs from the one intended by the output of an entrypoint.
+type Drift struct {
+	// Object is the address of the object, like `apps/v1/Deployment/ns/foo`.
+	Object string
+	// Field is the field path relative to the object, like `.spec.replicas`.
+	Field string
+	// Path is the field path of the intended value in the output, like `$.deployment.spec.replicas`.
+	Path string
+	// Intended and Live are the JSON values; Live is empty if the field is absent from the live object.
+	Intended string
+	Live     string
+}
+
+// LiveObjects returns the Kubernetes objects of a YAML stream, e.g. saved from `kubectl get -o yaml`.
+// Lists are flattened like Objects does.
+func LiveObjects(r io.Reader) ([]Object, error) {
+	var res []Object
+	d := jsonnet.NewYAMLToJSONDecoder(r)
+	for {
+		var doc json.RawMessage
+		if err := d.Decode(&doc); err == io.EOF {
+			return res, nil
+		} else if err != nil {
+			return nil, err
+		}
+		objs, err := Objects(string(doc))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, objs...)
+	}
+}
+
+// Drifts compares the live objects with the objects of the output that have the same address.
+// Only the fields set in the output are compared, since the cluster adds its own (status, defaults, etc).
+//
+// The cluster sets the namespace of namespaced objects, which manifests often leave out: a live object
+// that has no counterpart with its namespace matches the object of the output with the same apiVersion,
+// kind and name but no namespace, unless other live objects match it too.
+// Live objects that match no object of the output are returned as unmatched.
+func Drifts(output string, live []Object) ([]Drift, []Object, error) {
+	intended, err := Objects(output)
+	if err != nil {
+		return nil, nil, err
+	}
+	byAddress := map[string]Object{}
+	for _, o := range intended {
+		byAddress[o.Address()] = o
+	}
+	// live objects by the address they have without their namespace
+	unqualified := map[string]int{}
+	for _, l := range live {
+		if _, ok := byAddress[l.Address()]; !ok && l.Namespace != "" {
+			unqualified[withoutNamespace(l).Address()]++
+		}
+	}
+
+	var (
+		res       []Drift
+		unmatched []Object
+	)
+	for _, l := range live {
+		o, ok := byAddress[l.Address()]
+		if !ok && l.Namespace != "" {
+			addr := withoutNamespace(l).Address()
+			o, ok = byAddress[addr]
+			ok = ok && unqualified[addr] == 1
+		}
+		if !ok {
+			unmatched = append(unmatched, l)
+			continue
+		}
+		var changes []Change
+		driftValues(nil, o.Value, l.Value, true, &changes)
+		for _, c := range changes {
+			field := strings.TrimPrefix(c.Path, "$")
+			res = append(res, Drift{Object: o.Address(), Field: field, Path: o.Path + field, Intended: c.Before, Live: c.After})
+		}
+	}
+	return res, unmatched, nil
+}
+
+func withoutNamespace(o Object) Object {
+	o.Namespace = ""
+	return o
+}
+
+// driftValues records as changes the values of intended that differ in live, with Before the intended value.
+func driftValues(path fieldPath, intended, live interface{}, hasLive bool, res *[]Change) {
+	switch a := intended.(type) {
+	case map[string]interface{}:
+		if b, ok := live.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(a))
+			for k := range a {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				vb, okB := b[k]
+				driftValues(path.append(pathElem{Field: k}), a[k], vb, okB, res)
+			}
+			return
+		}
+	case []interface{}:
+		if b, ok := live.([]interface{}); ok && len(a) == len(b) {
+			for i := range a {
+				driftValues(path.append(pathElem{Index: i, IsIndex: true}), a[i], b[i], true, res)
+			}
+			return
+		}
+	}
+	if hasLive && reflect.DeepEqual(intended, live) {
+		return
+	}
+	c := Change{Path: path.String(), Before: toJSON(intended)}
+	if hasLive {
+		c.After = toJSON(live)
+	}
+	*res = append(*res, c)
+}
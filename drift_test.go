@@ -0,0 +1,141 @@
+package ursonnet
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const driftOutput = `{
+  "deployment": {
+    "apiVersion": "apps/v1",
+    "kind": "Deployment",
+    "metadata": {"name": "foo"},
+    "spec": {"replicas": 3, "template": {"spec": {"containers": [{"name": "foo", "image": "foo:1"}]}}}
+  },
+  "cm": {
+    "apiVersion": "v1",
+    "kind": "ConfigMap",
+    "metadata": {"name": "cm", "namespace": "ns"},
+    "data": {"a": "b"}
+  },
+  "ns": {"apiVersion": "v1", "kind": "Namespace", "metadata": {"name": "ns"}}
+}`
+
+func TestDrifts(t *testing.T) {
+	tests := []struct {
+		name      string
+		live      string
+		want      []Drift
+		unmatched []string
+	}{
+		{
+			name: "no drift",
+			live: `
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: cm, namespace: ns, uid: x}
+data: {a: b, extra: c}
+---
+apiVersion: v1
+kind: Namespace
+metadata: {name: ns}
+status: {phase: Active}
+`,
+		},
+		{
+			name: "changed field",
+			live: `
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: cm, namespace: ns}
+data: {a: c}
+---
+apiVersion: v1
+kind: Namespace
+metadata: {name: ns}
+`,
+			want: []Drift{
+				{Object: "v1/ConfigMap/ns/cm", Field: ".data.a", Path: "$.cm.data.a", Intended: `"b"`, Live: `"c"`},
+			},
+		},
+		{
+			name: "namespace set by the cluster",
+			live: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: foo, namespace: prod}
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - {name: foo, image: "foo:2", imagePullPolicy: Always}
+`,
+			want: []Drift{
+				{
+					Object: "apps/v1/Deployment/foo", Field: ".spec.template.spec.containers[0].image",
+					Path: "$.deployment.spec.template.spec.containers[0].image", Intended: `"foo:1"`, Live: `"foo:2"`,
+				},
+			},
+		},
+		{
+			name: "ambiguous namespaces",
+			live: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: foo, namespace: a}
+spec: {replicas: 1}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: foo, namespace: b}
+spec: {replicas: 2}
+`,
+			unmatched: []string{"apps/v1/Deployment/a/foo", "apps/v1/Deployment/b/foo"},
+		},
+		{
+			name: "list with unmatched objects and missing fields",
+			live: `
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata: {name: other, namespace: ns}
+- apiVersion: v1
+  kind: ConfigMap
+  metadata: {name: cm, namespace: other}
+- apiVersion: v1
+  kind: ConfigMap
+  metadata: {name: cm, namespace: ns}
+`,
+			want: []Drift{
+				{Object: "v1/ConfigMap/ns/cm", Field: ".data", Path: "$.cm.data", Intended: `{"a":"b"}`},
+			},
+			unmatched: []string{"v1/ConfigMap/ns/other", "v1/ConfigMap/other/cm"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			live, err := LiveObjects(strings.NewReader(test.live))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, unmatched, err := Drifts(driftOutput, live)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Drifts = %+v, want %+v", got, test.want)
+			}
+			var addresses []string
+			for _, o := range unmatched {
+				addresses = append(addresses, o.Address())
+			}
+			if !reflect.DeepEqual(addresses, test.unmatched) {
+				t.Errorf("unmatched = %q, want %q", addresses, test.unmatched)
+			}
+		})
+	}
+}
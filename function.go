@@ -0,0 +1,205 @@
+package ursonnet
+
+import (
+	"fmt"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+)
+
+// tlaPrefix prefixes the names that keep the values of the top-level arguments while they are traced.
+const tlaPrefix = "__ursonnet_tla_"
+
+// liftFunction supports entrypoints whose top level is a function, e.g. `function(env) {...}`.
+// Queries like `local $ = import f; expr` would see the function itself, so they are rewritten as
+// a function with the same parameters, in the scope of the top-level locals of f, that queries its body:
+//
+//	local x = ...; function(env) local $ = body; expr
+//
+// The VM applies the top-level arguments to the query like it would to the entrypoint.
+// The imports of the query must be expanded, with the entrypoint AST in files.
+// If trace is set, the parameters are traced when they're used, so that they count as roots.
+func liftFunction(vm *jsonnet.VM, query ast.Node, filename string, files map[string]ast.Node, trace bool) (ast.Node, error) {
+	foundAt, err := vm.ResolveImport(ursonnetTraceTag, filename)
+	if err != nil {
+		return nil, err
+	}
+	file := files[foundAt]
+	var locals []*ast.Local
+	body := file
+	for {
+		l, ok := body.(*ast.Local)
+		if !ok {
+			break
+		}
+		locals = append(locals, l)
+		body = l.Body
+	}
+	fn, ok := body.(*ast.Function)
+	if !ok {
+		return query, nil
+	}
+
+	cached := map[ast.Node]bool{}
+	for _, a := range files {
+		cached[a] = true
+	}
+	query, _ = substitute(query, file, fn.Body, cached)
+
+	res := &ast.Function{NodeBase: fn.NodeBase, Parameters: fn.Parameters, Body: query}
+	if trace {
+		res.Body = traceParameters(fn.Parameters, query)
+	}
+	res.SetFreeVariables(without(union(fn.FreeVariables(), res.Body.FreeVariables()), parameterNames(fn.Parameters)))
+	var lifted ast.Node = res
+	for i := len(locals) - 1; i >= 0; i-- {
+		l := *locals[i]
+		var bound ast.Identifiers
+		for _, b := range l.Binds {
+			bound = append(bound, b.Variable)
+		}
+		l.Body = lifted
+		l.SetFreeVariables(union(locals[i].FreeVariables(), without(lifted.FreeVariables(), bound)))
+		lifted = &l
+	}
+	return lifted, nil
+}
+
+// substitute replaces old with new in the nodes of the query itself, without descending into the files,
+// and reports whether old was found. The free variables of new are added to the nodes containing it.
+func substitute(a, old, new ast.Node, files map[ast.Node]bool) (ast.Node, bool) {
+	if a == old {
+		return new, true
+	}
+	if files[a] {
+		return a, false
+	}
+	found := false
+	for _, c := range queryChildren(a) {
+		var ok bool
+		if *c, ok = substitute(*c, old, new, files); ok {
+			found = true
+			a.SetFreeVariables(union(a.FreeVariables(), without((*c).FreeVariables(), boundBy(a))))
+		}
+	}
+	return a, found
+}
+
+// queryChildren returns pointers to the children of the nodes that can contain the entrypoint in queries.
+func queryChildren(a ast.Node) []*ast.Node {
+	switch a := a.(type) {
+	case *ast.Local:
+		res := []*ast.Node{&a.Body}
+		for i := range a.Binds {
+			res = append(res, &a.Binds[i].Body)
+		}
+		return res
+	case *ast.Index:
+		return []*ast.Node{&a.Target, &a.Index}
+	case *ast.Binary:
+		return []*ast.Node{&a.Left, &a.Right}
+	case *ast.Array:
+		var res []*ast.Node
+		for i := range a.Elements {
+			res = append(res, &a.Elements[i].Expr)
+		}
+		return res
+	}
+	return nil
+}
+
+// boundBy returns the variables bound by a in its query children.
+func boundBy(a ast.Node) ast.Identifiers {
+	var res ast.Identifiers
+	if l, ok := a.(*ast.Local); ok {
+		for _, b := range l.Binds {
+			res = append(res, b.Variable)
+		}
+	}
+	return res
+}
+
+// traceParameters rebinds the parameters to traced copies of their values in body:
+//
+//	local __ursonnet_tla_env = env; local env = std.trace(tag, __ursonnet_tla_env); body
+//
+// The trace is located at the parameter, so it's reported as a root when the value is used. Its message holds
+// the column of the parameter, since several parameters can share a line: the root is "file:line:column".
+func traceParameters(params []ast.Parameter, body ast.Node) ast.Node {
+	if len(params) == 0 {
+		return body
+	}
+	saved := &ast.Local{}
+	traced := &ast.Local{Body: body}
+	names := parameterNames(params)
+	var copies ast.Identifiers
+	for _, p := range params {
+		base := ast.NodeBase{LocRange: p.LocRange}
+		copied := ast.Identifier(tlaPrefix + string(p.Name))
+		copies = append(copies, copied)
+
+		saved.Binds = append(saved.Binds, ast.LocalBind{Variable: copied, Body: &ast.Var{Id: p.Name}})
+		value := &ast.Var{NodeBase: base, Id: copied}
+		value.SetFreeVariables(ast.Identifiers{copied})
+		call := &ast.Apply{
+			NodeBase: base,
+			Target: &ast.Index{
+				NodeBase: base,
+				Target:   &ast.Var{Id: "std"},
+				Index:    &ast.LiteralString{NodeBase: base, Value: "trace"},
+			},
+			Arguments: ast.Arguments{Positional: []ast.CommaSeparatedExpr{
+				{Expr: &ast.LiteralString{NodeBase: base, Value: fmt.Sprintf(":%d %s", p.LocRange.Begin.Column, ursonnetTraceTag)}},
+				{Expr: value},
+			}},
+		}
+		call.SetFreeVariables(ast.Identifiers{copied})
+		traced.Binds = append(traced.Binds, ast.LocalBind{Variable: p.Name, Body: call})
+	}
+	for _, b := range saved.Binds {
+		b.Body.SetFreeVariables(ast.Identifiers{b.Body.(*ast.Var).Id})
+	}
+	outer := without(body.FreeVariables(), names)
+	traced.SetFreeVariables(append(append(ast.Identifiers{}, outer...), copies...))
+	saved.SetFreeVariables(append(append(ast.Identifiers{}, outer...), names...))
+	saved.Body = traced
+	return saved
+}
+
+// union returns the union of sets of variables.
+func union(sets ...ast.Identifiers) ast.Identifiers {
+	var res ast.Identifiers
+	seen := map[ast.Identifier]bool{}
+	for _, vars := range sets {
+		for _, v := range vars {
+			if !seen[v] {
+				seen[v] = true
+				res = append(res, v)
+			}
+		}
+	}
+	return res
+}
+
+// without returns vars without the names.
+func without(vars ast.Identifiers, names ast.Identifiers) ast.Identifiers {
+	var res ast.Identifiers
+	for _, v := range vars {
+		bound := false
+		for _, n := range names {
+			bound = bound || n == v
+		}
+		if !bound {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func parameterNames(params []ast.Parameter) ast.Identifiers {
+	var res ast.Identifiers
+	for _, p := range params {
+		res = append(res, p.Name)
+	}
+	return res
+}
@@ -5,9 +5,12 @@ go 1.18
 require (
 	github.com/alecthomas/kong v0.8.1
 	github.com/google/go-jsonnet v0.20.0
+	golang.org/x/term v0.10.0
+	gopkg.in/yaml.v3 v3.0.1
+	sigs.k8s.io/yaml v1.1.0
 )
 
 require (
+	golang.org/x/sys v0.10.0 // indirect
 	gopkg.in/yaml.v2 v2.2.7 // indirect
-	sigs.k8s.io/yaml v1.1.0 // indirect
 )
@@ -0,0 +1,229 @@
+package ursonnet
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/google/go-jsonnet/toolutils"
+)
+
+// The field hooks are driven by two native functions called from the instrumented field bodies.
+// The enter probe runs a loop in jsonnet: it asks the native function what to do next and, while the
+// hook is suspended, evaluates the field paths requested through the Inspector in the scope of `self`.
+const (
+	enterHelper = `function(loc, name, s)
+  local describe(v) =
+    if std.isObject(v) then
+      { type: "object", fields: std.objectFields(v), hidden: std.setDiff(std.objectFieldsAll(v), std.objectFields(v)) }
+    else if std.isArray(v) then { type: "array", length: std.length(v) }
+    else if std.isFunction(v) then { type: "function" }
+    else { type: std.type(v), value: v };
+  local loop(reply) =
+    local cmd = std.native("ursonnet_enter")(loc, name, reply);
+    if cmd.op == "get" then loop(describe(std.foldl(function(v, k) v[k], cmd.path, s))) tailstrict else true;
+  loop(null)`
+	exitHelper = `function(loc, name, v) if std.native("ursonnet_exit")(loc, name, std.type(v)) then v else v`
+)
+
+// FieldHook is notified when the evaluation enters and leaves object fields.
+type FieldHook interface {
+	// Enter is called before the body of a field is evaluated. The evaluation is suspended until Enter
+	// returns, and in the meantime self can be used, from any goroutine, to inspect the object the field
+	// belongs to.
+	Enter(field EvaluatedField, self Inspector)
+	// Exit is called once the field is evaluated. Like jsonnet itself, it only evaluates the field to
+	// a value (e.g. an object), not deeply.
+	Exit(field EvaluatedField)
+}
+
+// EvaluatedField is a field being evaluated.
+type EvaluatedField struct {
+	// Location is the "file:line" location of the field, like the ones returned by Roots.
+	Location string
+	Name     string
+}
+
+// Inspector evaluates the value at a path (of field names and array indices) from an object.
+// Inspecting evaluates fields that might otherwise not be evaluated, or be evaluated later;
+// hooks are not called for those. Note that if the evaluation of the value fails, the whole
+// evaluation fails.
+type Inspector func(path ...interface{}) (*ValueDescription, error)
+
+// ValueDescription describes a value without evaluating its content.
+type ValueDescription struct {
+	// Type is the jsonnet type, as returned by std.type.
+	Type string
+	// Fields and Hidden are the visible and hidden fields of an object.
+	Fields []string
+	Hidden []string
+	// Length is the length of an array.
+	Length int
+	// Value is the value of scalars.
+	Value interface{}
+}
+
+// ErrEvaluationEnded is returned by an Inspector used after the evaluation ended.
+var ErrEvaluationEnded = errors.New("evaluation ended")
+
+// EvaluateWithHook evaluates the jsonnet file identified by filename, calling hook for every field evaluation.
+// It registers native functions on the vm.
+func EvaluateWithHook(vm *jsonnet.VM, filename string, hook FieldHook) (string, error) {
+	root, err := jsonnet.SnippetToAST(ursonnetTraceTag, fmt.Sprintf("import %q", filename))
+	if err != nil {
+		return "", err
+	}
+	root, err = expandImports(vm, root, map[string]ast.Node{}, nil)
+	if err != nil {
+		return "", err
+	}
+	enter, err := parseHelper(enterHelper)
+	if err != nil {
+		return "", err
+	}
+	exit, err := parseHelper(exitHelper)
+	if err != nil {
+		return "", err
+	}
+	injectHooks(root, enter, exit, map[ast.Node]bool{})
+	addStdFreeVariables(root, map[ast.Node]bool{})
+
+	h := &hookState{hook: hook, ended: make(chan struct{})}
+	defer close(h.ended)
+	vm.NativeFunction(&jsonnet.NativeFunction{Name: "ursonnet_enter", Params: ast.Identifiers{"loc", "name", "reply"}, Func: h.enter})
+	vm.NativeFunction(&jsonnet.NativeFunction{Name: "ursonnet_exit", Params: ast.Identifiers{"loc", "name", "type"}, Func: h.exit})
+
+	return vm.Evaluate(root)
+}
+
+// injectHooks wraps the body of every field f into `if enter(loc, name, self) then exit(loc, name, f) else null`.
+func injectHooks(a ast.Node, enter, exit ast.Node, seen map[ast.Node]bool) {
+	if seen[a] {
+		return
+	}
+	seen[a] = true
+
+	for _, c := range toolutils.Children(a) {
+		injectHooks(c, enter, exit, seen)
+	}
+	if o, ok := a.(*ast.DesugaredObject); ok {
+		for i, f := range o.Fields {
+			loc := &ast.LiteralString{Value: fmt.Sprintf("%s:%d", f.LocRange.FileName, f.LocRange.Begin.Line)}
+			var name ast.Node = &ast.LiteralString{Value: ""}
+			if n, ok := f.Name.(*ast.LiteralString); ok {
+				name = &ast.LiteralString{Value: n.Value}
+			}
+			o.Fields[i].Body = &ast.Conditional{
+				Cond:        apply(enter, loc, name, &ast.Self{}),
+				BranchTrue:  apply(exit, loc, name, f.Body),
+				BranchFalse: &ast.LiteralNull{},
+			}
+		}
+	}
+}
+
+type hookState struct {
+	hook FieldHook
+	// suspended holds the Enter calls in progress, innermost last.
+	suspended []*suspension
+	// inspecting is set while the jsonnet side evaluates a path requested by an Inspector.
+	inspecting bool
+	ended      chan struct{}
+}
+
+type suspension struct {
+	requests  chan []interface{}
+	responses chan interface{}
+	done      chan struct{}
+}
+
+func (h *hookState) enter(args []interface{}) (interface{}, error) {
+	loc, _ := args[0].(string)
+	name, _ := args[1].(string)
+	reply := args[2]
+
+	if reply == nil {
+		if h.inspecting {
+			return map[string]interface{}{"op": "continue"}, nil
+		}
+		s := &suspension{requests: make(chan []interface{}), responses: make(chan interface{}), done: make(chan struct{})}
+		h.suspended = append(h.suspended, s)
+		go func() {
+			defer close(s.done)
+			h.hook.Enter(EvaluatedField{Location: loc, Name: name}, h.inspector(s))
+		}()
+	} else {
+		h.inspecting = false
+		h.suspended[len(h.suspended)-1].responses <- reply
+	}
+
+	s := h.suspended[len(h.suspended)-1]
+	select {
+	case path := <-s.requests:
+		h.inspecting = true
+		return map[string]interface{}{"op": "get", "path": path}, nil
+	case <-s.done:
+		h.suspended = h.suspended[:len(h.suspended)-1]
+		return map[string]interface{}{"op": "continue"}, nil
+	}
+}
+
+func (h *hookState) exit(args []interface{}) (interface{}, error) {
+	if !h.inspecting {
+		loc, _ := args[0].(string)
+		name, _ := args[1].(string)
+		h.hook.Exit(EvaluatedField{Location: loc, Name: name})
+	}
+	return true, nil
+}
+
+func (h *hookState) inspector(s *suspension) Inspector {
+	return func(path ...interface{}) (*ValueDescription, error) {
+		p := []interface{}{}
+		for _, e := range path {
+			switch e := e.(type) {
+			case int:
+				p = append(p, float64(e))
+			case string:
+				p = append(p, e)
+			default:
+				return nil, fmt.Errorf("bad path element %v: must be a field name or an array index", e)
+			}
+		}
+		select {
+		case s.requests <- p:
+		case <-s.done:
+			return nil, fmt.Errorf("inspector used after Enter returned")
+		case <-h.ended:
+			return nil, ErrEvaluationEnded
+		}
+		select {
+		case r := <-s.responses:
+			return describeValue(r), nil
+		case <-h.ended:
+			return nil, ErrEvaluationEnded
+		}
+	}
+}
+
+func describeValue(r interface{}) *ValueDescription {
+	m, _ := r.(map[string]interface{})
+	d := &ValueDescription{Value: m["value"]}
+	d.Type, _ = m["type"].(string)
+	if n, ok := m["length"].(float64); ok {
+		d.Length = int(n)
+	}
+	for _, f := range asSlice(m["fields"]) {
+		d.Fields = append(d.Fields, fmt.Sprint(f))
+	}
+	for _, f := range asSlice(m["hidden"]) {
+		d.Hidden = append(d.Hidden, fmt.Sprint(f))
+	}
+	return d
+}
+
+func asSlice(v interface{}) []interface{} {
+	s, _ := v.([]interface{})
+	return s
+}
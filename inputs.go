@@ -0,0 +1,335 @@
+package ursonnet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/google/go-jsonnet/toolutils"
+)
+
+// InputKind is the kind of an Input.
+type InputKind string
+
+const (
+	InputExtVar InputKind = "extVar"
+	InputTLA    InputKind = "tla"
+	// InputField is a field with a literal value, e.g. in a config object.
+	InputField InputKind = "field"
+)
+
+// Input is something that can be set to change the output of an entrypoint.
+type Input struct {
+	Kind InputKind `json:"kind"`
+	// Name is the name of the ext var, top-level argument or field.
+	Name string `json:"name"`
+	// Sources are the "file:line" locations where the input is read (ext vars) or defined.
+	Sources []string `json:"sources"`
+	// Value is the literal value of a field or the default value of a top-level argument, as written,
+	// or the JSON value given to the top-level argument.
+	Value string `json:"value,omitempty"`
+	// Affects are the field paths of the output values the input affects, sorted.
+	Affects []string `json:"affects"`
+}
+
+// Inputs returns the inputs that influence the output of filename: the ext vars and top-level arguments
+// read while evaluating it and the fields with a literal value, wherever they are defined, that are roots
+// of at least one output value. Ext vars and top-level arguments come first, then fields by source.
+// Literal fields sharing a line are told apart by perturbing each of them like Verify does, at the cost of an
+// evaluation per field.
+func Inputs(c *Cache, filename string) ([]Input, error) {
+	blame, err := c.Blame(filename)
+	if err != nil {
+		return nil, err
+	}
+	affects := map[string]map[string]bool{}
+	for path, roots := range blame {
+		for _, r := range roots {
+			r = strings.TrimSpace(r)
+			if affects[r] == nil {
+				affects[r] = map[string]bool{}
+			}
+			affects[r][path] = true
+		}
+	}
+	var roots []string
+	for r := range affects {
+		roots = append(roots, r)
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		fi, li, _ := ParseRoot(roots[i])
+		fj, lj, _ := ParseRoot(roots[j])
+		if fi != fj {
+			return fi < fj
+		}
+		return li < lj
+	})
+
+	c.mu.Lock()
+	vm := c.vm
+	c.mu.Unlock()
+
+	byName := map[InputKind]map[string]*Input{InputExtVar: {}, InputTLA: {}}
+	var fields []*Input
+	var tlas map[string]string
+	var output interface{}
+	sources := map[string]*source{}
+	for _, r := range roots {
+		file, line, column, err := parseRootColumn(r)
+		if err != nil {
+			return nil, err
+		}
+		src, ok := sources[file]
+		if !ok {
+			if src, err = loadSource(vm, "", file); err != nil {
+				continue // e.g. fields defined in the query itself
+			}
+			sources[file] = src
+		}
+		add := func(kind InputKind, name, value string) {
+			in := byName[kind][name]
+			if in == nil {
+				in = &Input{Kind: kind, Name: name, Value: value}
+				byName[kind][name] = in
+			}
+			in.Sources = append(in.Sources, r)
+			for p := range affects[r] {
+				in.Affects = append(in.Affects, p)
+			}
+		}
+		for _, name := range src.extVarsAt(line) {
+			add(InputExtVar, name, "")
+		}
+		if p := src.parameterAt(line, column); p != nil {
+			if tlas == nil {
+				if tlas, err = tlaValues(vm, src); err != nil {
+					return nil, err
+				}
+			}
+			value, ok := tlas[string(p.Name)]
+			if !ok && p.DefaultArg != nil {
+				value = src.text(*p.DefaultArg.Loc())
+			}
+			add(InputTLA, string(p.Name), value)
+		}
+		var literals []*ast.DesugaredObjectField
+		for _, f := range src.fieldsAt(line) {
+			if isLiteral(f.Body) {
+				literals = append(literals, f)
+			}
+		}
+		var own map[*ast.DesugaredObjectField][]string
+		if len(literals) > 1 {
+			if output == nil {
+				out, err := c.Evaluate(filename, "$")
+				if err != nil {
+					return nil, err
+				}
+				if output, err = decodeJSON(out); err != nil {
+					return nil, err
+				}
+			}
+			if own, err = ownAffects(vm, filename, output, src, literals, affects[r]); err != nil {
+				return nil, err
+			}
+		}
+		for _, f := range literals {
+			name := src.text(*f.Name.Loc())
+			if n, ok := f.Name.(*ast.LiteralString); ok {
+				name = n.Value
+			}
+			in := &Input{Kind: InputField, Name: name, Sources: []string{r}, Value: src.text(*f.Body.Loc())}
+			if own != nil {
+				if in.Affects = own[f]; len(in.Affects) == 0 {
+					continue
+				}
+			} else {
+				for p := range affects[r] {
+					in.Affects = append(in.Affects, p)
+				}
+			}
+			fields = append(fields, in)
+		}
+	}
+
+	var res []Input
+	for _, kind := range []InputKind{InputExtVar, InputTLA} {
+		var names []string
+		for name := range byName[kind] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			res = append(res, *byName[kind][name])
+		}
+	}
+	for _, in := range fields {
+		res = append(res, *in)
+	}
+	for i := range res {
+		res[i].Affects = dedupe(res[i].Affects)
+	}
+	return res, nil
+}
+
+// ownAffects returns the paths, among the affected ones, whose value changes when the literal value of each field
+// is perturbed: the fields defined at a line are roots of the values of all of them.
+// want is the decoded output of filename.
+func ownAffects(vm *jsonnet.VM, filename string, want interface{}, src *source, fields []*ast.DesugaredObjectField, affected map[string]bool) (map[*ast.DesugaredObjectField][]string, error) {
+	res := map[*ast.DesugaredObjectField][]string{}
+	for _, f := range fields {
+		perturbed, err := perturbBodies(src, []ast.Node{f.Body})
+		if err != nil {
+			return nil, err
+		}
+		out, err := evaluatePatched(vm, filename, "$", func(foundAt, content string) (string, error) {
+			if matchesFile(foundAt, src.filename) {
+				return perturbed, nil
+			}
+			return content, nil
+		})
+		var got interface{}
+		if err == nil {
+			got, err = decodeJSON(out)
+		}
+		for p := range affected {
+			path, perr := parseFieldPath(p)
+			if perr != nil {
+				return nil, perr
+			}
+			before, _ := path.lookup(want)
+			after, ok := path.lookup(got)
+			// a failed evaluation tells nothing apart
+			if err != nil || !ok || toJSON(before) != toJSON(after) {
+				res[f] = append(res[f], p)
+			}
+		}
+	}
+	return res, nil
+}
+
+// tlaValues returns the values of the top-level arguments given to the function of src, as JSON,
+// by evaluating the function with a body returning them. Functions are given as "function".
+// Parameters without arguments are left out.
+func tlaValues(vm *jsonnet.VM, src *source) (map[string]string, error) {
+	a := src.node
+	for {
+		l, ok := a.(*ast.Local)
+		if !ok {
+			break
+		}
+		a = l.Body
+	}
+	fn, ok := a.(*ast.Function)
+	if !ok {
+		return nil, nil
+	}
+	// parameters that aren't given keep the tag as their value
+	var params, fields []string
+	for _, p := range fn.Parameters {
+		params = append(params, fmt.Sprintf("%s=%q", p.Name, ursonnetTraceTag))
+		fields = append(fields, fmt.Sprintf("%q: if std.isString(%s) && %s == %q then null else { value: if std.isFunction(%s) then 'function' else %s }",
+			p.Name, p.Name, p.Name, ursonnetTraceTag, p.Name, p.Name))
+	}
+	snippet := src.content[:src.offset(fn.Loc().Begin)] +
+		fmt.Sprintf("function(%s) { %s }", strings.Join(params, ", "), strings.Join(fields, ", "))
+	out, err := vm.EvaluateAnonymousSnippet(src.filename, snippet)
+	if err != nil {
+		return nil, err
+	}
+	values, err := decodeJSON(out)
+	if err != nil {
+		return nil, err
+	}
+	res := map[string]string{}
+	for name, v := range values.(map[string]interface{}) {
+		if v, ok := v.(map[string]interface{}); ok {
+			res[name] = toJSON(v["value"])
+		}
+	}
+	return res, nil
+}
+
+// extVarsAt returns the names of the ext vars read with std.extVar at the given line.
+func (s *source) extVarsAt(line int) []string {
+	var res []string
+	var walk func(a ast.Node)
+	walk = func(a ast.Node) {
+		if call, ok := a.(*ast.Apply); ok && call.Loc().Begin.Line == line {
+			if name, ok := extVarName(call); ok {
+				res = append(res, name)
+			}
+		}
+		for _, c := range toolutils.Children(a) {
+			walk(c)
+		}
+	}
+	walk(s.node)
+	return res
+}
+
+// text returns the source text of a location range.
+func (s *source) text(r ast.LocationRange) string {
+	return s.content[s.offset(r.Begin):s.offset(r.End)]
+}
+
+// extVarName returns the name of the ext var read by a call like `std.extVar("name")`.
+func extVarName(call *ast.Apply) (string, bool) {
+	if fn, ok := stdCall(call); !ok || fn != "extVar" {
+		return "", false
+	}
+	if len(call.Arguments.Positional) != 1 || len(call.Arguments.Named) != 0 {
+		return "", false
+	}
+	name, ok := call.Arguments.Positional[0].Expr.(*ast.LiteralString)
+	if !ok {
+		return "", false
+	}
+	return name.Value, true
+}
+
+// traceExtVar turns a `std.extVar(...)` call into a traced one, located at the call:
+//
+//	std.trace(tag, std.extVar(...))
+//
+// The call is changed in place and the original call, now its argument, is returned.
+func traceExtVar(call *ast.Apply) *ast.Apply {
+	inner := *call
+	base := ast.NodeBase{LocRange: call.LocRange}
+	base.SetFreeVariables(ast.Identifiers{"std"})
+	call.Target = &ast.Index{
+		NodeBase: base,
+		Target:   &ast.Var{NodeBase: base, Id: "std"},
+		Index:    &ast.LiteralString{NodeBase: base, Value: "trace"},
+	}
+	call.Arguments = ast.Arguments{Positional: []ast.CommaSeparatedExpr{
+		{Expr: &ast.LiteralString{NodeBase: base, Value: ursonnetTraceTag}},
+		{Expr: &inner},
+	}}
+	call.TailStrict = false
+	return &inner
+}
+
+func dedupe(s []string) []string {
+	sort.Strings(s)
+	var res []string
+	for i, v := range s {
+		if i == 0 || v != s[i-1] {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// String returns the kind in words.
+func (k InputKind) String() string {
+	switch k {
+	case InputExtVar:
+		return "ext var"
+	case InputTLA:
+		return "top-level argument"
+	}
+	return string(k)
+}
@@ -0,0 +1,80 @@
+package ursonnet
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+)
+
+func TestInputs(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "main.jsonnet")
+	const content = `function(env='dev', replicas=2) {
+  deployment: {
+    metadata: { name: 'foo-' + env },
+    spec: { replicas: replicas },
+    paused: std.extVar('paused'),
+  },
+  secret: { apiVersion: 'v1', kind: 'Secret', metadata: { name: 's' } },
+}
+`
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	root := func(loc string) []string { return []string{filename + ":" + loc} }
+	fields := []Input{
+		{Kind: InputField, Name: "apiVersion", Sources: root("7"), Value: "'v1'", Affects: []string{"$.secret.apiVersion"}},
+		{Kind: InputField, Name: "kind", Sources: root("7"), Value: "'Secret'", Affects: []string{"$.secret.kind"}},
+		{Kind: InputField, Name: "name", Sources: root("7"), Value: "'s'", Affects: []string{"$.secret.metadata.name"}},
+	}
+	tests := []struct {
+		name string
+		tlas map[string]string
+		want []Input
+	}{
+		{
+			name: "defaults",
+			want: append([]Input{
+				{Kind: InputExtVar, Name: "paused", Sources: root("5"), Affects: []string{"$.deployment.paused"}},
+				{Kind: InputTLA, Name: "env", Sources: root("1:10"), Value: "'dev'", Affects: []string{"$.deployment.metadata.name"}},
+				{Kind: InputTLA, Name: "replicas", Sources: root("1:21"), Value: "2", Affects: []string{"$.deployment.spec.replicas"}},
+			}, fields...),
+		},
+		{
+			name: "top-level arguments",
+			tlas: map[string]string{"env": "'prod'", "replicas": "{ n: 3 }.n"},
+			want: append([]Input{
+				{Kind: InputExtVar, Name: "paused", Sources: root("5"), Affects: []string{"$.deployment.paused"}},
+				{Kind: InputTLA, Name: "env", Sources: root("1:10"), Value: `"prod"`, Affects: []string{"$.deployment.metadata.name"}},
+				{Kind: InputTLA, Name: "replicas", Sources: root("1:21"), Value: "3", Affects: []string{"$.deployment.spec.replicas"}},
+			}, fields...),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewCache(func() *jsonnet.VM {
+				vm := jsonnet.MakeVM()
+				vm.ExtCode("paused", "false")
+				for name, code := range test.tlas {
+					vm.TLACode(name, code)
+				}
+				return vm
+			})
+			got, err := Inputs(c, filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range got {
+				for j, s := range got[i].Sources {
+					got[i].Sources[j] = strings.TrimSpace(s)
+				}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Inputs =\n%+v\nwant\n%+v", got, test.want)
+			}
+		})
+	}
+}
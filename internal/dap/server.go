@@ -0,0 +1,407 @@
+// Package dap implements a Debug Adapter Protocol server that suspends the evaluation of jsonnet
+// at object fields, using ursonnet.EvaluateWithHook.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/go-jsonnet"
+	"github.com/kubecfg/ursonnet"
+)
+
+// threadID is the only thread: jsonnet evaluation is single threaded.
+const threadID = 1
+
+type stepMode int
+
+const (
+	runFree  stepMode = iota
+	stepIn            // stop at the next field
+	stepOver          // stop at the next field that's not nested in the current one
+	stepOut           // stop at the next field after the current one is evaluated
+)
+
+// Server is a debug adapter speaking DAP over a stream, typically stdin/stdout.
+// Breakpoints are set on the lines where fields are defined; the evaluation stops
+// every time one of those fields is about to be evaluated.
+type Server struct {
+	// NewVM returns the VM used for the evaluation.
+	NewVM func() *jsonnet.VM
+
+	conn   *conn
+	launch launchArguments
+
+	mu sync.Mutex
+	// breakpoints are lines by absolute file path.
+	breakpoints map[string]map[int]bool
+	// frames are the fields being evaluated, innermost last.
+	frames []ursonnet.EvaluatedField
+	// stopped is set while the evaluation is suspended.
+	stopped *stop
+	entered bool
+	pause   bool
+	mode    stepMode
+	depth   int // of the field where stepping started
+	refs    map[int]varRef
+}
+
+type stop struct {
+	self   ursonnet.Inspector
+	resume chan func()
+}
+
+// varRef refers to the value at path from self, or to its elements if children is set.
+type varRef struct {
+	path     []interface{}
+	children bool
+}
+
+// Serve handles requests until the client disconnects.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.conn = &conn{r: bufio.NewReader(r), w: w}
+	s.breakpoints = map[string]map[int]bool{}
+	for {
+		req, err := s.conn.read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		body, err := s.handle(req)
+		resp := &response{RequestSeq: req.Seq, Command: req.Command, Success: err == nil, Body: body}
+		if err != nil {
+			resp.Message = err.Error()
+		}
+		if err := s.conn.write(resp); err != nil {
+			return err
+		}
+		switch req.Command {
+		case "initialize":
+			if err := s.conn.event("initialized", nil); err != nil {
+				return err
+			}
+		case "configurationDone":
+			go s.run()
+		case "disconnect", "terminate":
+			return nil
+		}
+	}
+}
+
+func (s *Server) handle(req *request) (interface{}, error) {
+	switch req.Command {
+	case "initialize":
+		return map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		}, nil
+	case "launch":
+		if err := json.Unmarshal(req.Arguments, &s.launch); err != nil {
+			return nil, err
+		}
+		if s.launch.Program == "" {
+			return nil, fmt.Errorf("missing program")
+		}
+		return nil, nil
+	case "setBreakpoints":
+		var args setBreakpointsArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		lines := map[int]bool{}
+		res := []breakpoint{}
+		for _, b := range args.Breakpoints {
+			lines[b.Line] = true
+			res = append(res, breakpoint{Verified: true, Line: b.Line})
+		}
+		s.mu.Lock()
+		s.breakpoints[ursonnet.AbsPath(args.Source.Path)] = lines
+		s.mu.Unlock()
+		return map[string]interface{}{"breakpoints": res}, nil
+	case "setExceptionBreakpoints", "configurationDone", "disconnect", "terminate":
+		return nil, nil
+	case "threads":
+		return map[string]interface{}{"threads": []interface{}{map[string]interface{}{"id": threadID, "name": "evaluation"}}}, nil
+	case "stackTrace":
+		return s.stackTrace(), nil
+	case "scopes":
+		var args scopesArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.scopes(args.FrameID), nil
+	case "variables":
+		var args variablesArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.variables(args.VariablesReference)
+	case "evaluate":
+		var args evaluateArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.evaluate(args.Expression)
+	case "continue":
+		return map[string]interface{}{"allThreadsContinued": true}, s.resume(runFree)
+	case "next":
+		return nil, s.resume(stepOver)
+	case "stepIn":
+		return nil, s.resume(stepIn)
+	case "stepOut":
+		return nil, s.resume(stepOut)
+	case "pause":
+		s.mu.Lock()
+		s.pause = true
+		s.mu.Unlock()
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported request %q", req.Command)
+}
+
+// run evaluates the program and reports its output.
+func (s *Server) run() {
+	out, err := ursonnet.EvaluateWithHook(s.NewVM(), s.launch.Program, s)
+	exitCode := 0
+	if err != nil {
+		exitCode = 1
+		s.conn.event("output", map[string]interface{}{"category": "stderr", "output": err.Error() + "\n"})
+	} else {
+		s.conn.event("output", map[string]interface{}{"category": "stdout", "output": out})
+	}
+	s.conn.event("exited", map[string]interface{}{"exitCode": exitCode})
+	s.conn.event("terminated", nil)
+}
+
+// Enter implements ursonnet.FieldHook.
+func (s *Server) Enter(field ursonnet.EvaluatedField, self ursonnet.Inspector) {
+	s.mu.Lock()
+	depth := len(s.frames)
+	s.frames = append(s.frames, field)
+	reason := s.stopReason(field, depth)
+	if reason == "" {
+		s.mu.Unlock()
+		return
+	}
+	st := &stop{self: self, resume: make(chan func())}
+	s.stopped, s.refs, s.pause, s.entered = st, map[int]varRef{}, false, true
+	s.mu.Unlock()
+
+	s.conn.event("stopped", map[string]interface{}{"reason": reason, "threadId": threadID, "allThreadsStopped": true})
+	(<-st.resume)()
+}
+
+// Exit implements ursonnet.FieldHook.
+func (s *Server) Exit(field ursonnet.EvaluatedField) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n := len(s.frames); n > 0 {
+		s.frames = s.frames[:n-1]
+	}
+}
+
+// stopReason returns why the evaluation should stop at field, if it should. s.mu must be held.
+func (s *Server) stopReason(field ursonnet.EvaluatedField, depth int) string {
+	switch {
+	case s.pause:
+		return "pause"
+	case !s.entered && s.launch.StopOnEntry:
+		return "entry"
+	case s.mode == stepIn, s.mode == stepOver && depth <= s.depth, s.mode == stepOut && depth < s.depth:
+		return "step"
+	}
+	file, line, err := ursonnet.ParseRoot(field.Location)
+	if err == nil && s.breakpoints[ursonnet.AbsPath(file)][line] {
+		return "breakpoint"
+	}
+	return ""
+}
+
+func (s *Server) resume(mode stepMode) error {
+	s.mu.Lock()
+	st := s.stopped
+	if st == nil {
+		s.mu.Unlock()
+		return fmt.Errorf("not stopped")
+	}
+	s.stopped, s.refs = nil, nil
+	s.mu.Unlock()
+
+	st.resume <- func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.mode, s.depth = mode, len(s.frames)-1
+	}
+	return nil
+}
+
+func (s *Server) stackTrace() interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	frames := []stackFrame{}
+	for i := len(s.frames) - 1; i >= 0; i-- {
+		f := s.frames[i]
+		file, line, _ := ursonnet.ParseRoot(f.Location)
+		name := f.Name
+		if name == "" {
+			name = "[computed field]"
+		}
+		path := ursonnet.AbsPath(file)
+		frames = append(frames, stackFrame{
+			ID:     i,
+			Name:   name,
+			Source: source{Name: filepath.Base(path), Path: path},
+			Line:   line,
+			Column: 1,
+		})
+	}
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}
+}
+
+// scopes returns the object of the innermost field: only there the evaluation is suspended.
+func (s *Server) scopes(frame int) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := []scope{}
+	if s.stopped != nil && frame == len(s.frames)-1 {
+		res = append(res, scope{Name: "self", VariablesReference: s.newRef(varRef{path: []interface{}{}, children: true})})
+	}
+	return map[string]interface{}{"scopes": res}
+}
+
+func (s *Server) variables(ref int) (interface{}, error) {
+	s.mu.Lock()
+	st := s.stopped
+	r, ok := s.refs[ref]
+	s.mu.Unlock()
+	if st == nil || !ok {
+		return nil, fmt.Errorf("not stopped")
+	}
+
+	d, err := st.self(r.path...)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := []variable{}
+	if !r.children {
+		// the value of a lazy variable
+		res = append(res, s.variable(valueName(r.path), r.path, d))
+		return map[string]interface{}{"variables": res}, nil
+	}
+	lazy := func(name string, e interface{}, visibility string) {
+		path := append(append([]interface{}{}, r.path...), e)
+		res = append(res, variable{
+			Name:               name,
+			VariablesReference: s.newRef(varRef{path: path}),
+			PresentationHint:   &variablePresentationHint{Lazy: true, Visibility: visibility},
+		})
+	}
+	for _, f := range d.Fields {
+		lazy(f, f, "")
+	}
+	for _, f := range d.Hidden {
+		lazy(f, f, "private")
+	}
+	for i := 0; i < d.Length; i++ {
+		lazy(fmt.Sprintf("[%d]", i), i, "")
+	}
+	return map[string]interface{}{"variables": res}, nil
+}
+
+// variable renders a value; objects and arrays can be expanded. s.mu must be held.
+func (s *Server) variable(name string, path []interface{}, d *ursonnet.ValueDescription) variable {
+	v := variable{Name: name, Type: d.Type}
+	switch d.Type {
+	case "object":
+		v.Value = fmt.Sprintf("{%d fields}", len(d.Fields))
+		v.VariablesReference = s.newRef(varRef{path: path, children: true})
+	case "array":
+		v.Value = fmt.Sprintf("[%d elements]", d.Length)
+		v.VariablesReference = s.newRef(varRef{path: path, children: true})
+	case "function":
+		v.Value = "function"
+	default:
+		b, _ := json.Marshal(d.Value)
+		v.Value = string(b)
+	}
+	return v
+}
+
+// evaluate supports field paths from self, like `self.a.b[0]` or `a["b"]`.
+func (s *Server) evaluate(expr string) (interface{}, error) {
+	path, err := parsePath(expr)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	st := s.stopped
+	s.mu.Unlock()
+	if st == nil {
+		return nil, fmt.Errorf("not stopped")
+	}
+	d, err := st.self(path...)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := s.variable(expr, path, d)
+	return map[string]interface{}{"result": v.Value, "type": v.Type, "variablesReference": v.VariablesReference}, nil
+}
+
+// newRef allocates a variables reference. s.mu must be held.
+func (s *Server) newRef(r varRef) int {
+	if s.refs == nil {
+		s.refs = map[int]varRef{}
+	}
+	id := len(s.refs) + 1
+	s.refs[id] = r
+	return id
+}
+
+var pathElem = regexp.MustCompile(`^(?:\.?([A-Za-z_][A-Za-z0-9_]*)|\[(\d+)\]|\["([^"]*)"\]|\['([^']*)'\])`)
+
+func parsePath(expr string) ([]interface{}, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(expr), "self")
+	path := []interface{}{}
+	for rest != "" {
+		m := pathElem.FindStringSubmatch(rest)
+		if m == nil {
+			return nil, fmt.Errorf("only field paths from self are supported, like self.a.b[0]")
+		}
+		switch {
+		case m[2] != "":
+			i, _ := strconv.Atoi(m[2])
+			path = append(path, i)
+		default:
+			path = append(path, m[1]+m[3]+m[4])
+		}
+		rest = rest[len(m[0]):]
+	}
+	return path, nil
+}
+
+func valueName(path []interface{}) string {
+	if len(path) == 0 {
+		return "self"
+	}
+	switch e := path[len(path)-1].(type) {
+	case int:
+		return fmt.Sprintf("[%d]", e)
+	default:
+		return fmt.Sprint(e)
+	}
+}
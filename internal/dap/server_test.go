@@ -0,0 +1,194 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+)
+
+// message is any message sent by the server, with the body left undecoded.
+type message struct {
+	Type    string          `json:"type"`
+	Event   string          `json:"event"`
+	Command string          `json:"command"`
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Body    json.RawMessage `json:"body"`
+}
+
+// client drives a server over pipes, like an editor would.
+type client struct {
+	t   *testing.T
+	w   io.Writer
+	r   *bufio.Reader
+	seq int
+}
+
+func (c *client) send(command string, args interface{}) {
+	c.t.Helper()
+	c.seq++
+	arguments, err := json.Marshal(args)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	body, err := json.Marshal(request{Seq: c.seq, Command: command, Arguments: arguments})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) read() *message {
+	c.t.Helper()
+	header, err := textproto.NewReader(c.r).ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	n, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		c.t.Fatal(err)
+	}
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		c.t.Fatal(err)
+	}
+	return &msg
+}
+
+// until skips messages until the event or the response to the command named name, and decodes its body into v.
+func (c *client) until(typ, name string, v interface{}) {
+	c.t.Helper()
+	for {
+		msg := c.read()
+		if msg.Type != typ || msg.Event+msg.Command != name {
+			continue
+		}
+		if msg.Type == "response" && !msg.Success {
+			c.t.Fatalf("%s: %s", name, msg.Message)
+		}
+		if v != nil {
+			if err := json.Unmarshal(msg.Body, v); err != nil {
+				c.t.Fatalf("%s: %v", name, err)
+			}
+		}
+		return
+	}
+}
+
+// call sends a request and decodes the body of its response into v.
+func (c *client) call(command string, args, v interface{}) {
+	c.t.Helper()
+	c.send(command, args)
+	c.until("response", command, v)
+}
+
+func TestServe(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.libsonnet")
+	main := filepath.Join(dir, "main.jsonnet")
+	files := map[string]string{
+		lib: `{
+  name: 'foo',
+  greeting: 'hello ' + self.name,
+}
+`,
+		main: `(import 'lib.libsonnet') {
+  name: 'bar',
+}
+`,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- (&Server{NewVM: jsonnet.MakeVM}).Serve(inR, outW)
+		outW.Close()
+	}()
+	c := &client{t: t, w: inW, r: bufio.NewReader(outR)}
+
+	c.call("initialize", map[string]string{"adapterID": "ursonnet"}, nil)
+	c.until("event", "initialized", nil)
+	c.call("launch", launchArguments{Program: main}, nil)
+	var bps struct{ Breakpoints []breakpoint }
+	c.call("setBreakpoints", map[string]interface{}{
+		"source":      source{Path: lib},
+		"breakpoints": []map[string]int{{"line": 3}},
+	}, &bps)
+	if len(bps.Breakpoints) != 1 || !bps.Breakpoints[0].Verified {
+		t.Errorf("breakpoints = %+v", bps.Breakpoints)
+	}
+	c.call("configurationDone", nil, nil)
+
+	var stopped struct{ Reason string }
+	c.until("event", "stopped", &stopped)
+	if stopped.Reason != "breakpoint" {
+		t.Errorf("stopped because of %q, want breakpoint", stopped.Reason)
+	}
+
+	var trace struct{ StackFrames []stackFrame }
+	c.call("stackTrace", map[string]int{"threadId": threadID}, &trace)
+	if len(trace.StackFrames) == 0 {
+		t.Fatal("no stack frames")
+	}
+	top := trace.StackFrames[0]
+	if top.Name != "greeting" || top.Source.Path != lib || top.Line != 3 {
+		t.Errorf("top frame = %+v, want greeting at %s:3", top, lib)
+	}
+
+	var scopes struct{ Scopes []scope }
+	c.call("scopes", scopesArguments{FrameID: top.ID}, &scopes)
+	if len(scopes.Scopes) != 1 {
+		t.Fatalf("scopes = %+v", scopes.Scopes)
+	}
+	var vars struct{ Variables []variable }
+	c.call("variables", variablesArguments{VariablesReference: scopes.Scopes[0].VariablesReference}, &vars)
+	refs := map[string]int{}
+	for _, v := range vars.Variables {
+		refs[v.Name] = v.VariablesReference
+	}
+	if len(refs) != 2 || refs["name"] == 0 || refs["greeting"] == 0 {
+		t.Fatalf("variables of self = %+v, want name and greeting", vars.Variables)
+	}
+	c.call("variables", variablesArguments{VariablesReference: refs["name"]}, &vars)
+	if len(vars.Variables) != 1 || vars.Variables[0].Value != `"bar"` {
+		t.Errorf("variables of name = %+v, want \"bar\"", vars.Variables)
+	}
+	var eval struct{ Result string }
+	c.call("evaluate", evaluateArguments{Expression: "self.name"}, &eval)
+	if eval.Result != `"bar"` {
+		t.Errorf("self.name = %s, want \"bar\"", eval.Result)
+	}
+
+	c.call("continue", map[string]int{"threadId": threadID}, nil)
+	var output struct{ Category, Output string }
+	c.until("event", "output", &output)
+	if output.Category != "stdout" || !strings.Contains(output.Output, `"greeting": "hello bar"`) {
+		t.Errorf("output = %+v", output)
+	}
+	c.until("event", "terminated", nil)
+	c.call("disconnect", nil, nil)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
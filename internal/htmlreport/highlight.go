@@ -0,0 +1,105 @@
+package htmlreport
+
+import (
+	"html/template"
+	"strings"
+)
+
+var keywords = map[string]bool{
+	"assert": true, "else": true, "error": true, "false": true, "for": true, "function": true, "if": true,
+	"import": true, "importstr": true, "importbin": true, "in": true, "local": true, "null": true,
+	"tailstrict": true, "then": true, "self": true, "super": true, "true": true,
+}
+
+// highlight splits jsonnet source into lines of HTML, with comments, strings, numbers and keywords
+// wrapped in spans. It's a lexer good enough for display, not a parser: a text block is taken to end
+// at the first line starting with |||.
+func highlight(src string) []template.HTML {
+	var res []template.HTML
+	var b strings.Builder
+	state := "" // the class of the token that continues on the next line
+	for _, line := range strings.Split(strings.TrimSuffix(src, "\n"), "\n") {
+		b.Reset()
+		i := 0
+		switch state {
+		case "c":
+			end := strings.Index(line, "*/")
+			if end < 0 {
+				span(&b, "c", line)
+				res = append(res, template.HTML(b.String()))
+				continue
+			}
+			span(&b, "c", line[:end+2])
+			i, state = end+2, ""
+		case "s":
+			span(&b, "s", line)
+			if strings.HasPrefix(strings.TrimSpace(line), "|||") {
+				state = ""
+			}
+			res = append(res, template.HTML(b.String()))
+			continue
+		}
+		for i < len(line) {
+			c := line[i]
+			switch {
+			case c == '#' || strings.HasPrefix(line[i:], "//"):
+				span(&b, "c", line[i:])
+				i = len(line)
+			case strings.HasPrefix(line[i:], "/*"):
+				end := strings.Index(line[i+2:], "*/")
+				if end < 0 {
+					span(&b, "c", line[i:])
+					i, state = len(line), "c"
+					break
+				}
+				span(&b, "c", line[i:i+2+end+2])
+				i += 2 + end + 2
+			case strings.HasPrefix(line[i:], "|||"):
+				span(&b, "s", line[i:])
+				i, state = len(line), "s"
+			case c == '"' || c == '\'':
+				j := i + 1
+				for j < len(line) && line[j] != c {
+					if line[j] == '\\' {
+						j++
+					}
+					j++
+				}
+				if j >= len(line) {
+					j = len(line) - 1
+				}
+				span(&b, "s", line[i:j+1])
+				i = j + 1
+			case c >= '0' && c <= '9':
+				j := i
+				for j < len(line) && strings.IndexByte("0123456789.eE", line[j]) >= 0 {
+					j++
+				}
+				span(&b, "n", line[i:j])
+				i = j
+			case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+				j := i
+				for j < len(line) && (line[j] == '_' || line[j] >= 'a' && line[j] <= 'z' || line[j] >= 'A' && line[j] <= 'Z' || line[j] >= '0' && line[j] <= '9') {
+					j++
+				}
+				if keywords[line[i:j]] {
+					span(&b, "k", line[i:j])
+				} else {
+					b.WriteString(template.HTMLEscapeString(line[i:j]))
+				}
+				i = j
+			default:
+				b.WriteString(template.HTMLEscapeString(line[i : i+1]))
+				i++
+			}
+		}
+		res = append(res, template.HTML(b.String()))
+	}
+	return res
+}
+
+func span(b *strings.Builder, class, text string) {
+	b.WriteString(`<span class="` + class + `">`)
+	b.WriteString(template.HTMLEscapeString(text))
+	b.WriteString(`</span>`)
+}
@@ -0,0 +1,246 @@
+// Package htmlreport renders a self-contained HTML page showing the output of a jsonnet file next to the
+// sources, where clicking a value highlights its roots.
+package htmlreport
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kubecfg/ursonnet"
+)
+
+// Report is what the page shows.
+type Report struct {
+	Entrypoint string
+	// Output is the JSON output of the entrypoint.
+	Output string
+	// Roots holds the roots of the leaves of the output, by field path, as returned by ursonnet.Cache.Blame.
+	Roots map[string][]string
+	// Redactor redacts the values influenced by secrets, which are flagged; nil redacts nothing.
+	Redactor *ursonnet.Redactor
+}
+
+type file struct {
+	Name  string
+	Lines []line
+}
+
+type line struct {
+	N    int
+	HTML template.HTML
+}
+
+type root struct {
+	File int    `json:"file"`
+	Line int    `json:"line"`
+	Root string `json:"root"`
+}
+
+// Write writes the page. The source files are read from disk: the entrypoint and the files of the roots.
+func Write(w io.Writer, r Report) error {
+	names := map[string]int{r.Entrypoint: 0}
+	var files []*file
+	for _, roots := range r.Roots {
+		for _, rt := range roots {
+			if name, _, err := ursonnet.ParseRoot(rt); err == nil {
+				names[name] = 0
+			}
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		if name != r.Entrypoint {
+			sorted = append(sorted, name)
+		}
+	}
+	sort.Strings(sorted)
+	for i, name := range append([]string{r.Entrypoint}, sorted...) {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		names[name] = i
+		f := &file{Name: name}
+		for n, l := range highlight(string(src)) {
+			f.Lines = append(f.Lines, line{N: n + 1, HTML: l})
+		}
+		files = append(files, f)
+	}
+
+	roots := map[string][]root{}
+	for path, rs := range r.Roots {
+		roots[path] = []root{}
+		for _, rt := range rs {
+			name, line, err := ursonnet.ParseRoot(rt)
+			if err != nil {
+				continue
+			}
+			roots[path] = append(roots[path], root{File: names[name], Line: line, Root: strings.TrimSpace(rt)})
+		}
+	}
+
+	output, err := renderOutput(r.Redactor.Output(r.Output), r.Redactor)
+	if err != nil {
+		return err
+	}
+	return page.Execute(w, map[string]interface{}{
+		"Entrypoint": r.Entrypoint,
+		"Output":     output,
+		"Files":      files,
+		"Roots":      roots,
+	})
+}
+
+// renderOutput pretty prints the JSON output with the leaves wrapped in clickable spans,
+// flagging the leaves influenced by secrets.
+func renderOutput(output string, redactor *ursonnet.Redactor) (template.HTML, error) {
+	d := json.NewDecoder(strings.NewReader(output))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	var render func(v interface{}, path []interface{}, indent string)
+	leaf := func(text string, path []interface{}) {
+		p := ursonnet.FieldPathOf(path...)
+		class := "leaf"
+		if redactor.Secret(p) {
+			class += " secret"
+		}
+		fmt.Fprintf(&b, `<span class="%s" data-path="%s">%s</span>`,
+			class, template.HTMLEscapeString(p), template.HTMLEscapeString(text))
+	}
+	render = func(v interface{}, path []interface{}, indent string) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if len(v) == 0 {
+				leaf("{}", path)
+				return
+			}
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			b.WriteString("{\n")
+			for i, k := range keys {
+				b.WriteString(indent + "  " + template.HTMLEscapeString(marshal(k)) + ": ")
+				render(v[k], append(append([]interface{}{}, path...), k), indent+"  ")
+				if i < len(keys)-1 {
+					b.WriteString(",")
+				}
+				b.WriteString("\n")
+			}
+			b.WriteString(indent + "}")
+		case []interface{}:
+			if len(v) == 0 {
+				leaf("[]", path)
+				return
+			}
+			b.WriteString("[\n")
+			for i, e := range v {
+				b.WriteString(indent + "  ")
+				render(e, append(append([]interface{}{}, path...), i), indent+"  ")
+				if i < len(v)-1 {
+					b.WriteString(",")
+				}
+				b.WriteString("\n")
+			}
+			b.WriteString(indent + "]")
+		default:
+			leaf(marshal(v), path)
+		}
+	}
+	render(v, nil, "")
+	return template.HTML(b.String()), nil
+}
+
+// marshal encodes v as JSON, leaving HTML characters like those of "<redacted>" to be escaped when written.
+func marshal(v interface{}) string {
+	var b strings.Builder
+	e := json.NewEncoder(&b)
+	e.SetEscapeHTML(false)
+	e.Encode(v) // v was decoded from JSON
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+var page = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>ursonnet: {{.Entrypoint}}</title>
+<style>
+body { margin: 0; font: 13px/1.4 ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; color: #24292f; }
+header { padding: 8px 16px; border-bottom: 1px solid #d0d7de; font-family: system-ui, sans-serif; }
+main { display: flex; height: calc(100vh - 41px); }
+#output, #sources { overflow: auto; padding: 8px 16px; }
+#output { flex: 0 0 40%; border-right: 1px solid #d0d7de; }
+#sources { flex: 1; }
+pre { margin: 0; }
+.leaf { cursor: pointer; border-radius: 3px; }
+.leaf:hover { background: #eaeef2; }
+.leaf.selected { background: #ffd33d; }
+.leaf.secret { color: #cf222e; font-style: italic; }
+#chain { position: sticky; top: 0; background: #f6f8fa; border: 1px solid #d0d7de; padding: 8px; margin-bottom: 12px; }
+#chain ol { margin: 4px 0 0; padding-left: 24px; }
+#chain a { color: #0969da; cursor: pointer; }
+h2 { font-size: 13px; margin: 16px 0 4px; }
+table { border-collapse: collapse; }
+td.n { color: #8c959f; text-align: right; padding-right: 12px; user-select: none; }
+td.l { white-space: pre; }
+tr.hl { background: #fff8c5; }
+tr.hl td.n { color: #24292f; font-weight: bold; }
+.c { color: #6e7781; } .s { color: #0a3069; } .n { color: #0550ae; } .k { color: #cf222e; }
+</style>
+</head>
+<body>
+<header>Output of <b>{{.Entrypoint}}</b>. Click a value to highlight its roots in the sources.</header>
+<main>
+<div id="output"><pre>{{.Output}}</pre></div>
+<div id="sources">
+<div id="chain">Select a value.</div>
+{{range $i, $f := .Files}}<h2 id="file{{$i}}">{{$f.Name}}</h2>
+<table>{{range $f.Lines}}<tr id="file{{$i}}-L{{.N}}"><td class="n">{{.N}}</td><td class="l">{{.HTML}}</td></tr>{{end}}</table>
+{{end}}</div>
+</main>
+<script>
+const roots = {{.Roots}};
+const row = (r) => document.getElementById("file" + r.file + "-L" + r.line);
+document.getElementById("output").addEventListener("click", (e) => {
+  const leaf = e.target.closest(".leaf");
+  if (!leaf) return;
+  document.querySelectorAll(".selected, .hl").forEach((el) => el.classList.remove("selected", "hl"));
+  leaf.classList.add("selected");
+  const path = leaf.dataset.path;
+  const rs = roots[path] || [];
+  const chain = document.getElementById("chain");
+  chain.textContent = "";
+  const title = document.createElement("b");
+  title.textContent = path;
+  chain.append(title, rs.length ? " is produced by, most relevant first:" : " has no roots.");
+  const list = document.createElement("ol");
+  rs.forEach((r) => {
+    const tr = row(r);
+    if (tr) tr.classList.add("hl");
+    const a = document.createElement("a");
+    a.textContent = r.root;
+    a.addEventListener("click", () => row(r) && row(r).scrollIntoView({block: "center"}));
+    const code = document.createElement("code");
+    code.textContent = tr ? "  " + tr.querySelector("td.l").textContent.trim() : "";
+    const li = document.createElement("li");
+    li.append(a, code);
+    list.append(li);
+  });
+  chain.append(list);
+  if (rs.length && row(rs[0])) row(rs[0]).scrollIntoView({block: "center"});
+});
+</script>
+</body>
+</html>
+`))
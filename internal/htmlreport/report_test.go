@@ -0,0 +1,69 @@
+package htmlreport
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+	"github.com/kubecfg/ursonnet"
+)
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.libsonnet")
+	main := filepath.Join(dir, "main.jsonnet")
+	files := map[string]string{
+		lib: "{\n  name: 'foo<bar>',\n}\n",
+		main: `local lib = import 'lib.libsonnet';
+{
+  name: lib.name,
+  password: std.extVar('password'),
+}
+`,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cache := ursonnet.NewCache(func() *jsonnet.VM {
+		vm := jsonnet.MakeVM()
+		vm.ExtVar("password", "hunter2")
+		return vm
+	})
+	output, err := cache.Evaluate(main, "$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots, err := cache.Blame(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redactor, err := ursonnet.NewRedactor(cache, main, []string{"password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	if err := Write(&b, Report{Entrypoint: main, Output: output, Roots: roots, Redactor: redactor}); err != nil {
+		t.Fatal(err)
+	}
+	page := b.String()
+	for _, want := range []string{
+		// the entrypoint comes first, then the files of the roots
+		`<h2 id="file0">` + main + `</h2>`,
+		`<h2 id="file1">` + lib + `</h2>`,
+		`<span class="leaf" data-path="$.name">&#34;foo&lt;bar&gt;&#34;</span>`,
+		`<span class="leaf secret" data-path="$.password">&#34;&lt;redacted&gt;&#34;</span>`,
+		`"root":"` + lib + `:2"`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("the page doesn't contain %s:\n%s", want, page)
+		}
+	}
+	if strings.Contains(page, "hunter2") {
+		t.Errorf("the page contains the secret:\n%s", page)
+	}
+}
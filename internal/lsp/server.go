@@ -0,0 +1,350 @@
+// Package lsp implements a language server that answers questions about jsonnet code by evaluating
+// an entrypoint, which lets it resolve self, super and $ through the actual inheritance chain.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/google/go-jsonnet"
+	"github.com/kubecfg/ursonnet"
+)
+
+const (
+	// maxHoverValues limits the number of distinct values shown on hover.
+	maxHoverValues = 5
+	// maxValueLength limits the length of each value shown on hover.
+	maxValueLength = 2000
+)
+
+// Server is a language server speaking LSP over a stream, typically stdin/stdout.
+type Server struct {
+	// Entrypoint is the jsonnet file evaluated to answer queries. If empty, the initializationOptions
+	// "entrypoint" setting is used and, failing that, the document being queried.
+	Entrypoint string
+	// NewVM returns the VM used for each evaluation.
+	NewVM func() *jsonnet.VM
+
+	conn *conn
+	root string
+	// docs holds the contents of the open documents, by path.
+	docs map[string]string
+}
+
+// Serve handles requests until the client sends the exit notification or closes the stream.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.conn = &conn{r: bufio.NewReader(r), w: w}
+	s.docs = map[string]string{}
+	for {
+		msg, err := s.conn.read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		result, err := s.handle(msg)
+		if msg.ID == nil {
+			if err != nil {
+				log.Printf("%s: %v", msg.Method, err)
+			}
+			continue
+		}
+		if err := s.conn.reply(msg.ID, result, err); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg *message) (interface{}, error) {
+	switch msg.Method {
+	case "initialize":
+		var p initializeParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		if p.RootURI != "" {
+			s.root = uriToPath(p.RootURI)
+		}
+		if s.Entrypoint == "" && p.InitializationOptions.Entrypoint != "" {
+			s.Entrypoint = p.InitializationOptions.Entrypoint
+			if !filepath.IsAbs(s.Entrypoint) && s.root != "" {
+				s.Entrypoint = filepath.Join(s.root, s.Entrypoint)
+			}
+		}
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1, // full
+				"definitionProvider": true,
+				"hoverProvider":      true,
+				"codeLensProvider":   map[string]interface{}{"resolveProvider": false},
+			},
+			"serverInfo": map[string]interface{}{"name": "ursonnet"},
+		}, nil
+	case "initialized", "textDocument/didSave", "$/cancelRequest", "$/setTrace":
+		return nil, nil
+	case "shutdown":
+		return nil, nil
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		s.docs[uriToPath(p.TextDocument.URI)] = p.TextDocument.Text
+		return nil, nil
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		if n := len(p.ContentChanges); n > 0 {
+			s.docs[uriToPath(p.TextDocument.URI)] = p.ContentChanges[n-1].Text
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		delete(s.docs, uriToPath(p.TextDocument.URI))
+		return nil, nil
+	case "textDocument/definition":
+		var p textDocumentPositionParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.definition(p)
+	case "textDocument/hover":
+		var p textDocumentPositionParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.hover(p)
+	case "textDocument/codeLens":
+		var p codeLensParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.codeLens(p)
+	}
+	if msg.ID == nil {
+		return nil, nil // notifications can be ignored
+	}
+	return nil, &methodNotFoundError{msg.Method}
+}
+
+// query returns the arguments shared by the ursonnet probes for a position in a document.
+func (s *Server) query(p textDocumentPositionParams) (entrypoint, file string, line, column int) {
+	file = uriToPath(p.TextDocument.URI)
+	line = p.Position.Line + 1
+	column = toColumn(lineOf(s.content(file), line), p.Position.Character)
+	return s.entrypoint(file), file, line, column
+}
+
+func (s *Server) entrypoint(file string) string {
+	if s.Entrypoint != "" {
+		return s.Entrypoint
+	}
+	return file
+}
+
+func (s *Server) definition(p textDocumentPositionParams) (interface{}, error) {
+	entrypoint, file, line, column := s.query(p)
+	defs, err := ursonnet.Definitions(s.NewVM(), entrypoint, file, line, column, ursonnet.Overlay(s.docs))
+	if err != nil {
+		log.Printf("definition: %v", err)
+		return nil, nil
+	}
+	res := []location{}
+	for _, d := range defs {
+		if loc, ok := s.location(d); ok {
+			res = append(res, loc)
+		}
+	}
+	return res, nil
+}
+
+func (s *Server) hover(p textDocumentPositionParams) (interface{}, error) {
+	entrypoint, file, line, column := s.query(p)
+	probes, err := ursonnet.Probe(s.NewVM(), entrypoint, file, line, column, ursonnet.Overlay(s.docs))
+	if err != nil {
+		log.Printf("hover: %v", err)
+		return nil, nil
+	}
+	if len(probes) == 0 {
+		return &hover{Contents: markupContent{Kind: "markdown", Value: "not evaluated by " + s.relative(entrypoint)}}, nil
+	}
+	var b strings.Builder
+	for i, r := range probes {
+		if i == maxHoverValues {
+			fmt.Fprintf(&b, "\n... %d more values\n", len(probes)-i)
+			break
+		}
+		if i > 0 {
+			b.WriteString("\n---\n")
+		}
+		value := r.Value
+		if len(value) > maxValueLength {
+			value = value[:maxValueLength] + "..."
+		}
+		fmt.Fprintf(&b, "```json\n%s\n```\n", value)
+		if len(r.Roots) > 0 {
+			b.WriteString("\nroots:\n")
+		}
+		for _, root := range r.Roots {
+			fmt.Fprintf(&b, "- %s\n", s.relative(root))
+		}
+	}
+	return &hover{Contents: markupContent{Kind: "markdown", Value: b.String()}}, nil
+}
+
+func (s *Server) codeLens(p codeLensParams) (interface{}, error) {
+	file := uriToPath(p.TextDocument.URI)
+	overrides, err := ursonnet.Overrides(s.NewVM(), s.entrypoint(file), file, ursonnet.Overlay(s.docs))
+	if err != nil {
+		log.Printf("codeLens: %v", err)
+		return nil, nil
+	}
+	var fields []string
+	for field := range overrides {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	res := []codeLens{}
+	for _, field := range fields {
+		by := overrides[field]
+		loc, ok := s.location(field)
+		if !ok {
+			continue
+		}
+		var titles []string
+		for _, b := range by {
+			if strings.HasPrefix(b, "+") {
+				titles = append(titles, "extended in "+s.relative(b[1:]))
+			} else {
+				titles = append(titles, "overridden in "+s.relative(b))
+			}
+		}
+		res = append(res, codeLens{Range: loc.Range, Command: command{Title: strings.Join(titles, ", ")}})
+	}
+	return res, nil
+}
+
+// location converts a "file:line" root into an LSP location spanning the text of the line.
+func (s *Server) location(root string) (location, bool) {
+	file, line, err := ursonnet.ParseRoot(root)
+	if err != nil {
+		return location{}, false
+	}
+	file, err = filepath.Abs(file)
+	if err != nil {
+		return location{}, false
+	}
+	text := lineOf(s.content(file), line)
+	trimmed := strings.TrimLeft(text, " \t")
+	start := utf16Len(text[:len(text)-len(trimmed)])
+	return location{
+		URI: pathToURI(file),
+		Range: rangeT{
+			Start: position{Line: line - 1, Character: start},
+			End:   position{Line: line - 1, Character: utf16Len(text)},
+		},
+	}, true
+}
+
+// content returns the text of an open document, or else of the file on disk.
+func (s *Server) content(file string) string {
+	if text, ok := s.docs[file]; ok {
+		return text
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// relative shortens paths in the workspace for display.
+func (s *Server) relative(path string) string {
+	if s.root == "" {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(s.root, abs); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func pathToURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// lineOf returns the 1-based line of text, without the line terminator.
+func lineOf(text string, line int) string {
+	for i := 1; i < line; i++ {
+		n := strings.IndexByte(text, '\n')
+		if n < 0 {
+			return ""
+		}
+		text = text[n+1:]
+	}
+	if n := strings.IndexByte(text, '\n'); n >= 0 {
+		text = text[:n]
+	}
+	return strings.TrimSuffix(text, "\r")
+}
+
+// toColumn converts an LSP character offset, counted in UTF-16 code units,
+// into a 1-based jsonnet column, counted in runes.
+func toColumn(line string, character int) int {
+	col := 1
+	for _, r := range line {
+		if character <= 0 {
+			break
+		}
+		character -= runeLen16(r)
+		col++
+	}
+	return col
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeLen16(r)
+	}
+	return n
+}
+
+// runeLen16 returns the number of UTF-16 code units needed to encode r.
+func runeLen16(r rune) int {
+	if utf16.IsSurrogate(r) || r < 0x10000 {
+		return 1
+	}
+	return 2
+}
@@ -0,0 +1,143 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+)
+
+// session writes the requests to a server, framed as the client would, and returns the responses by ID.
+func session(t *testing.T, s *Server, requests ...message) map[string]*message {
+	t.Helper()
+	var in, out bytes.Buffer
+	c := &conn{w: &in}
+	for i := range requests {
+		if err := c.write(&requests[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Serve(&in, &out); err != nil {
+		t.Fatal(err)
+	}
+	res := map[string]*message{}
+	c = &conn{r: bufio.NewReader(&out)}
+	for out.Len() > 0 || c.r.Buffered() > 0 {
+		msg, err := c.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res[string(*msg.ID)] = msg
+	}
+	return res
+}
+
+func request(id int, method string, params interface{}) message {
+	raw := json.RawMessage(fmt.Sprint(id))
+	msg := notification(method, params)
+	msg.ID = &raw
+	return msg
+}
+
+func notification(method string, params interface{}) message {
+	b, err := json.Marshal(params)
+	if err != nil {
+		panic(err)
+	}
+	return message{Method: method, Params: b}
+}
+
+func TestServe(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.libsonnet")
+	main := filepath.Join(dir, "main.jsonnet")
+	files := map[string]string{
+		lib: `{
+  name: 'foo',
+  greeting: 'hello ' + self.name,
+}
+`,
+		main: `(import 'lib.libsonnet') {
+  name: 'bar',
+}
+`,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	at := func(file string, line, character int) textDocumentPositionParams {
+		return textDocumentPositionParams{
+			TextDocument: textDocumentIdentifier{URI: pathToURI(file)},
+			Position:     position{Line: line, Character: character},
+		}
+	}
+
+	res := session(t, &Server{NewVM: jsonnet.MakeVM},
+		request(1, "initialize", map[string]interface{}{
+			"rootUri":               pathToURI(dir),
+			"initializationOptions": map[string]string{"entrypoint": "main.jsonnet"},
+		}),
+		notification("initialized", struct{}{}),
+		request(2, "textDocument/hover", at(lib, 2, 4)),
+		request(3, "textDocument/definition", at(lib, 2, 29)),
+		// Unsaved changes are evaluated instead of the file on disk.
+		notification("textDocument/didOpen", didOpenParams{TextDocument: textDocumentItem{
+			URI:  pathToURI(main),
+			Text: strings.Replace(files[main], "bar", "baz", 1),
+		}}),
+		request(4, "textDocument/hover", at(lib, 2, 4)),
+		request(5, "textDocument/unknown", struct{}{}),
+		request(6, "shutdown", nil),
+		notification("exit", nil),
+	)
+
+	hovers := map[string]string{"2": `"hello bar"`, "4": `"hello baz"`}
+	for id, want := range hovers {
+		var h hover
+		if err := remarshal(res[id], &h); err != nil {
+			t.Fatalf("hover %s: %v", id, err)
+		}
+		if !strings.Contains(h.Contents.Value, want) || !strings.Contains(h.Contents.Value, "main.jsonnet:2") {
+			t.Errorf("hover %s = %q, want %s with root main.jsonnet:2", id, h.Contents.Value, want)
+		}
+	}
+
+	var defs []location
+	if err := remarshal(res["3"], &defs); err != nil {
+		t.Fatalf("definition: %v", err)
+	}
+	want := location{URI: pathToURI(main), Range: rangeT{Start: position{1, 2}, End: position{1, 14}}}
+	if len(defs) != 1 || defs[0] != want {
+		t.Errorf("definition = %+v, want %+v", defs, want)
+	}
+
+	if msg := res["5"]; msg == nil || msg.Error == nil || msg.Error.Code != codeMethodNotFound {
+		t.Errorf("unknown method = %+v, want method not found", msg)
+	}
+	if msg := res["6"]; msg == nil || msg.Error != nil {
+		t.Errorf("shutdown = %+v", msg)
+	}
+}
+
+// remarshal decodes the result of a response into v.
+func remarshal(msg *message, v interface{}) error {
+	if msg == nil {
+		return fmt.Errorf("no response")
+	}
+	if msg.Error != nil {
+		return fmt.Errorf("%s", msg.Error.Message)
+	}
+	b, err := json.Marshal(msg.Result)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
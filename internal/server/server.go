@@ -0,0 +1,164 @@
+// Package server implements a local HTTP JSON API answering queries on jsonnet files from a warm cache.
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/kubecfg/ursonnet"
+)
+
+// Server answers:
+//
+//	GET  /roots?file=F&path=P     {"roots": ["file:line", ...]}
+//	GET  /eval?file=F&path=P      {"value": ...}, with "secret": true if influenced by Secrets
+//	GET  /blame?file=F            {"roots": {"$.a.b": ["file:line", ...], ...}}
+//	GET  /impact?file=F&root=R    {"paths": ["$.a.b", ...]}
+//	POST /invalidate              {"files": ["file", ...]} -> {"dropped": ["file", ...]}
+//
+// path defaults to "$" and can be an object address, like apps/v1/Deployment/ns/foo:.spec.replicas. Errors are returned as {"error": "..."}.
+type Server struct {
+	// NewVM returns the VM used for evaluations. A new VM is used after files change.
+	NewVM func() *jsonnet.VM
+	// Secrets are the ext vars and top-level arguments whose values are secret: the eval values they influence are redacted.
+	Secrets []string
+
+	cache *ursonnet.Cache
+}
+
+// Handler returns the HTTP handler of the API.
+func (s *Server) Handler() http.Handler {
+	s.cache = ursonnet.NewCache(s.NewVM)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/roots", s.get(func(r *http.Request) (interface{}, error) {
+		p, err := s.fieldPath(r)
+		if err != nil {
+			return nil, err
+		}
+		roots, err := s.cache.Roots(r.FormValue("file"), p)
+		return map[string]interface{}{"roots": trimRoots(roots)}, err
+	}))
+	mux.HandleFunc("/eval", s.get(func(r *http.Request) (interface{}, error) {
+		p, err := s.fieldPath(r)
+		if err != nil {
+			return nil, err
+		}
+		value, err := s.cache.Evaluate(r.FormValue("file"), p)
+		if err != nil {
+			return nil, err
+		}
+		redactor, err := ursonnet.NewRedactor(s.cache, r.FormValue("file"), s.Secrets)
+		if err != nil {
+			return nil, err
+		}
+		if redactor.Secret(p) {
+			return map[string]interface{}{"value": json.RawMessage(redactor.Value(p, value)), "secret": true}, nil
+		}
+		return map[string]interface{}{"value": json.RawMessage(value)}, nil
+	}))
+	mux.HandleFunc("/blame", s.get(func(r *http.Request) (interface{}, error) {
+		blame, err := s.cache.Blame(r.FormValue("file"))
+		res := map[string][]string{}
+		for p, roots := range blame {
+			res[p] = trimRoots(roots)
+		}
+		return map[string]interface{}{"roots": res}, err
+	}))
+	mux.HandleFunc("/impact", s.get(func(r *http.Request) (interface{}, error) {
+		if r.FormValue("root") == "" {
+			return nil, badRequest("missing root parameter")
+		}
+		paths, err := s.cache.Impact(r.FormValue("file"), r.FormValue("root"))
+		return map[string]interface{}{"paths": nonNil(paths)}, err
+	}))
+	mux.HandleFunc("/invalidate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			reply(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+			return
+		}
+		var req struct {
+			Files []string `json:"files"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			reply(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		reply(w, http.StatusOK, map[string]interface{}{"dropped": nonNil(s.cache.Invalidate(req.Files...))})
+	})
+	return mux
+}
+
+type badRequest string
+
+func (e badRequest) Error() string { return string(e) }
+
+// get wraps a query handler: queries need a file, evaluation errors are reported as 422.
+func (s *Server) get(query func(r *http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			reply(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+			return
+		}
+		if r.FormValue("file") == "" {
+			reply(w, http.StatusBadRequest, map[string]string{"error": "missing file parameter"})
+			return
+		}
+		res, err := query(r)
+		switch err.(type) {
+		case nil:
+			reply(w, http.StatusOK, res)
+		case badRequest:
+			reply(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		default:
+			reply(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		}
+	}
+}
+
+func reply(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("writing response: %v", err)
+	}
+}
+
+// fieldPath returns the path parameter, with object addresses translated into field paths.
+func (s *Server) fieldPath(r *http.Request) (string, error) {
+	p := path(r)
+	if !ursonnet.IsAddress(p) {
+		return p, nil
+	}
+	output, err := s.cache.Evaluate(r.FormValue("file"), "$")
+	if err != nil {
+		return "", err
+	}
+	return ursonnet.AddressFieldPath(output, p)
+}
+
+func path(r *http.Request) string {
+	if p := r.FormValue("path"); p != "" {
+		return p
+	}
+	return "$"
+}
+
+// trimRoots drops the trailing space of the roots returned by ursonnet.
+func trimRoots(roots []string) []string {
+	res := []string{}
+	for _, r := range roots {
+		res = append(res, strings.TrimSpace(r))
+	}
+	return res
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
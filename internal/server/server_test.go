@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+)
+
+func TestHandler(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.libsonnet")
+	main := filepath.Join(dir, "main.jsonnet")
+	write := func(path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(lib, "{\n  name: 'foo',\n}\n")
+	write(main, `local lib = import 'lib.libsonnet';
+{
+  name: lib.name,
+  password: std.extVar('password'),
+}
+`)
+	s := &Server{
+		NewVM: func() *jsonnet.VM {
+			vm := jsonnet.MakeVM()
+			vm.ExtVar("password", "hunter2")
+			return vm
+		},
+		Secrets: []string{"password"},
+	}
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	call := func(method, endpoint string, query url.Values, body string) (int, map[string]interface{}) {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+endpoint+"?"+query.Encode(), strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var res map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, res
+	}
+
+	tests := []struct {
+		method, endpoint string
+		query            url.Values
+		status           int
+		want             map[string]interface{}
+	}{
+		{"GET", "/roots", url.Values{"file": {main}, "path": {"$.name"}}, 200,
+			map[string]interface{}{"roots": []interface{}{main + ":3", lib + ":2"}}},
+		{"GET", "/eval", url.Values{"file": {main}, "path": {"$.name"}}, 200,
+			map[string]interface{}{"value": "foo"}},
+		{"GET", "/eval", url.Values{"file": {main}, "path": {"$.password"}}, 200,
+			map[string]interface{}{"value": "<redacted>", "secret": true}},
+		{"GET", "/impact", url.Values{"file": {main}, "root": {lib + ":2"}}, 200,
+			map[string]interface{}{"paths": []interface{}{"$.name"}}},
+		{"GET", "/roots", url.Values{"path": {"$.name"}}, 400,
+			map[string]interface{}{"error": "missing file parameter"}},
+		{"GET", "/impact", url.Values{"file": {main}}, 400,
+			map[string]interface{}{"error": "missing root parameter"}},
+		{"POST", "/eval", url.Values{"file": {main}}, 405,
+			map[string]interface{}{"error": "use GET"}},
+	}
+	for _, test := range tests {
+		status, res := call(test.method, test.endpoint, test.query, "")
+		if status != test.status || !reflect.DeepEqual(res, test.want) {
+			t.Errorf("%s %s?%s = %d %v, want %d %v", test.method, test.endpoint, test.query.Encode(), status, res, test.status, test.want)
+		}
+	}
+
+	if status, res := call("GET", "/eval", url.Values{"file": {main}, "path": {"$.nope"}}, ""); status != 422 || res["error"] == nil {
+		t.Errorf("evaluating a missing field = %d %v, want 422 with an error", status, res)
+	}
+
+	// changed files are picked up without invalidating them; the size changes too, in case modification times are coarse
+	write(lib, "{\n  name: 'bar2',\n}\n")
+	if _, res := call("GET", "/eval", url.Values{"file": {main}, "path": {"$.name"}}, ""); res["value"] != "bar2" {
+		t.Errorf("value after changing %s = %v, want bar2", lib, res["value"])
+	}
+
+	body, err := json.Marshal(map[string][]string{"files": {lib}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, res := call("POST", "/invalidate", nil, string(body)); status != 200 || !reflect.DeepEqual(res["dropped"], []interface{}{lib, main}) {
+		t.Errorf("invalidate = %d %v, want %s and %s dropped", status, res, lib, main)
+	}
+	if _, res := call("GET", "/eval", url.Values{"file": {main}, "path": {"$.name"}}, ""); res["value"] != "bar2" {
+		t.Errorf("value after invalidating %s = %v, want bar2", lib, res["value"])
+	}
+}
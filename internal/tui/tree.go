@@ -0,0 +1,107 @@
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kubecfg/ursonnet"
+)
+
+// node is a value of the evaluated output.
+type node struct {
+	key      string
+	path     string
+	depth    int
+	value    string // JSON, for scalars
+	isArray  bool
+	children []*node // nil for scalars
+	expanded bool
+}
+
+func (n *node) container() bool { return n.children != nil }
+
+// summary is what's shown after the key in the tree.
+func (n *node) summary() string {
+	switch {
+	case !n.container():
+		return n.value
+	case n.isArray:
+		return fmt.Sprintf("[%d]", len(n.children))
+	default:
+		return fmt.Sprintf("{%d}", len(n.children))
+	}
+}
+
+// buildTree parses the JSON output into a tree. Object keys are sorted, like jsonnet manifests them.
+func buildTree(output string) (*node, error) {
+	d := json.NewDecoder(strings.NewReader(output))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	root := newNode("$", nil, v)
+	root.expanded = true
+	return root, nil
+}
+
+func newNode(key string, path []interface{}, v interface{}) *node {
+	n := &node{key: key, path: ursonnet.FieldPathOf(path...), depth: len(path)}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		n.children = []*node{}
+		for _, k := range keys {
+			n.children = append(n.children, newNode(k, appendPath(path, k), v[k]))
+		}
+	case []interface{}:
+		n.isArray = true
+		n.children = []*node{}
+		for i, e := range v {
+			n.children = append(n.children, newNode(fmt.Sprintf("[%d]", i), appendPath(path, i), e))
+		}
+	default:
+		b, _ := json.Marshal(v)
+		n.value = string(b)
+	}
+	return n
+}
+
+func appendPath(path []interface{}, e interface{}) []interface{} {
+	return append(append([]interface{}{}, path...), e)
+}
+
+// visible returns the nodes shown in the tree, in order.
+func visible(n *node) []*node {
+	res := []*node{n}
+	if n.expanded {
+		for _, c := range n.children {
+			res = append(res, visible(c)...)
+		}
+	}
+	return res
+}
+
+// expandedPaths returns the paths of the expanded nodes, so that they can be restored after a reload.
+func expandedPaths(n *node, res map[string]bool) map[string]bool {
+	if n.expanded {
+		res[n.path] = true
+	}
+	for _, c := range n.children {
+		expandedPaths(c, res)
+	}
+	return res
+}
+
+func restoreExpanded(n *node, paths map[string]bool) {
+	n.expanded = n.expanded || paths[n.path]
+	for _, c := range n.children {
+		restoreExpanded(c, paths)
+	}
+}
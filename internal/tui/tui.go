@@ -0,0 +1,380 @@
+// Package tui implements an interactive terminal explorer of the evaluated output of a jsonnet file,
+// showing the roots of the selected values.
+package tui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/go-jsonnet"
+	"github.com/kubecfg/ursonnet"
+	"golang.org/x/term"
+)
+
+const help = "↑↓ move  ←→ fold  enter roots  tab switch pane  e edit  r reload  q quit"
+
+// Explorer shows the output of a jsonnet file as a collapsible tree.
+type Explorer struct {
+	Filename string
+	// NewVM returns the VM used for each evaluation.
+	NewVM func() *jsonnet.VM
+	// Secrets are the ext vars and top-level arguments whose values are secret: the values they influence are redacted.
+	Secrets []string
+
+	in  *os.File
+	out io.Writer
+
+	root      *node
+	cursor    int
+	scroll    int
+	roots     map[string]*rootsResult
+	focus     pane
+	rootIndex int
+	status    string
+	sources   map[string][]string
+}
+
+type pane int
+
+const (
+	treePane pane = iota
+	rootsPane
+)
+
+type rootsResult struct {
+	roots []string
+	err   error
+}
+
+// Run takes over the terminal until the user quits.
+func (e *Explorer) Run() error {
+	e.in, e.out = os.Stdin, os.Stdout
+	if !term.IsTerminal(int(e.in.Fd())) {
+		return fmt.Errorf("the explorer needs a terminal")
+	}
+	if err := e.reload(); err != nil {
+		return err
+	}
+
+	restore, err := e.enterScreen()
+	if err != nil {
+		return err
+	}
+	defer func() { restore() }()
+
+	buf := make([]byte, 64)
+	for {
+		e.render()
+		n, err := e.in.Read(buf)
+		if err != nil {
+			return err
+		}
+		switch key := string(buf[:n]); key {
+		case "q", "\x03":
+			return nil
+		case "\x1b[A", "k":
+			e.move(-1)
+		case "\x1b[B", "j":
+			e.move(1)
+		case "\x1b[5~":
+			e.move(-e.height())
+		case "\x1b[6~", " ":
+			e.move(e.height())
+		case "g":
+			e.move(-1 << 30)
+		case "G":
+			e.move(1 << 30)
+		case "\x1b[C", "l":
+			e.fold(true)
+		case "\x1b[D", "h":
+			e.fold(false)
+		case "\r", "\n":
+			e.selectNode()
+		case "\t":
+			if e.focus == treePane && e.selectedRoots() != nil {
+				e.focus = rootsPane
+			} else {
+				e.focus = treePane
+			}
+		case "e":
+			restore()
+			editErr := e.edit()
+			if restore, err = e.enterScreen(); err != nil {
+				return err
+			}
+			if editErr != nil {
+				e.status = editErr.Error()
+			}
+		case "r":
+			if err := e.reload(); err != nil {
+				e.status = err.Error()
+			} else {
+				e.status = "reloaded"
+			}
+		}
+	}
+}
+
+// enterScreen switches to the alternate screen in raw mode and returns a function restoring the terminal.
+func (e *Explorer) enterScreen() (func(), error) {
+	state, err := term.MakeRaw(int(e.in.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprint(e.out, "\x1b[?1049h\x1b[?25l")
+	return func() {
+		fmt.Fprint(e.out, "\x1b[?25h\x1b[?1049l")
+		term.Restore(int(e.in.Fd()), state)
+	}, nil
+}
+
+// reload evaluates the file again, keeping the expanded nodes and the cursor.
+func (e *Explorer) reload() error {
+	out, err := e.NewVM().EvaluateFile(e.Filename)
+	if err != nil {
+		return err
+	}
+	redactor, err := ursonnet.NewRedactor(ursonnet.NewCache(e.NewVM), e.Filename, e.Secrets)
+	if err != nil {
+		return err
+	}
+	root, err := buildTree(redactor.Output(out))
+	if err != nil {
+		return err
+	}
+	var cursorPath string
+	if e.root != nil {
+		restoreExpanded(root, expandedPaths(e.root, map[string]bool{}))
+		cursorPath = e.selected().path
+	}
+	e.root, e.cursor, e.focus = root, 0, treePane
+	e.roots, e.sources = map[string]*rootsResult{}, map[string][]string{}
+	for i, n := range visible(root) {
+		if n.path == cursorPath {
+			e.cursor = i
+		}
+	}
+	return nil
+}
+
+func (e *Explorer) selected() *node {
+	return visible(e.root)[e.cursor]
+}
+
+func (e *Explorer) selectedRoots() []string {
+	if r := e.roots[e.selected().path]; r != nil && r.err == nil && len(r.roots) > 0 {
+		return r.roots
+	}
+	return nil
+}
+
+func (e *Explorer) move(delta int) {
+	if e.focus == rootsPane {
+		e.rootIndex = clamp(e.rootIndex+delta, 0, len(e.selectedRoots())-1)
+		return
+	}
+	e.cursor = clamp(e.cursor+delta, 0, len(visible(e.root))-1)
+	e.rootIndex = 0
+	e.status = ""
+}
+
+// fold expands or collapses the selected node; collapsing a leaf or a collapsed node moves to its parent.
+func (e *Explorer) fold(expand bool) {
+	e.focus = treePane
+	n := e.selected()
+	if n.container() && n.expanded != expand {
+		n.expanded = expand
+		return
+	}
+	if !expand {
+		nodes := visible(e.root)
+		for i := e.cursor - 1; i >= 0; i-- {
+			if nodes[i].depth < n.depth {
+				e.cursor = i
+				return
+			}
+		}
+	}
+}
+
+// selectNode toggles containers and computes the roots of leaves.
+func (e *Explorer) selectNode() {
+	n := e.selected()
+	if n.container() && n != e.root {
+		n.expanded = !n.expanded
+		return
+	}
+	if _, ok := e.roots[n.path]; !ok {
+		roots, err := ursonnet.Roots(e.NewVM(), e.Filename, n.path)
+		for i := range roots {
+			roots[i] = strings.TrimSpace(roots[i])
+		}
+		e.roots[n.path] = &rootsResult{roots: roots, err: err}
+	}
+	e.rootIndex = 0
+}
+
+// edit opens $VISUAL or $EDITOR at the selected root.
+func (e *Explorer) edit() error {
+	roots := e.selectedRoots()
+	if roots == nil {
+		return fmt.Errorf("select a leaf with enter first")
+	}
+	file, line, err := ursonnet.ParseRoot(roots[e.rootIndex])
+	if err != nil {
+		return err
+	}
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	args := append(strings.Fields(editor), fmt.Sprintf("+%d", line), file)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+func (e *Explorer) height() int {
+	_, h, err := term.GetSize(int(e.in.Fd()))
+	if err != nil || h < 3 {
+		return 1
+	}
+	return h - 1 // the status line
+}
+
+func (e *Explorer) render() {
+	w, _, err := term.GetSize(int(e.in.Fd()))
+	if err != nil {
+		w = 80
+	}
+	h := e.height()
+	treeWidth := w * 55 / 100
+	detailWidth := w - treeWidth - 1
+
+	nodes := visible(e.root)
+	if e.cursor < e.scroll {
+		e.scroll = e.cursor
+	}
+	if e.cursor >= e.scroll+h {
+		e.scroll = e.cursor - h + 1
+	}
+	details := e.details(detailWidth)
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for row := 0; row < h; row++ {
+		if i := e.scroll + row; i < len(nodes) {
+			n := nodes[i]
+			marker := "  "
+			if n.container() && n != e.root {
+				marker = "▸ "
+				if n.expanded {
+					marker = "▾ "
+				}
+			}
+			text := fit(strings.Repeat("  ", n.depth)+marker+n.key+": "+n.summary(), treeWidth)
+			if i == e.cursor {
+				text = highlight(text, e.focus == treePane)
+			}
+			b.WriteString(text)
+		} else {
+			b.WriteString(strings.Repeat(" ", treeWidth))
+		}
+		b.WriteString("│")
+		if row < len(details) {
+			b.WriteString(details[row])
+		} else {
+			b.WriteString(strings.Repeat(" ", detailWidth))
+		}
+		b.WriteString("\r\n")
+	}
+	status := e.status
+	if status == "" {
+		status = help
+	}
+	b.WriteString(fit(status, w))
+	fmt.Fprint(e.out, b.String())
+}
+
+// details renders the pane describing the selected node: its path, value and roots with their source lines.
+func (e *Explorer) details(width int) []string {
+	n := e.selected()
+	lines := []string{fit(n.path, width)}
+	if !n.container() {
+		lines = append(lines, fit("= "+n.value, width))
+	}
+	lines = append(lines, fit("", width))
+	r := e.roots[n.path]
+	switch {
+	case r == nil && n.container() && n != e.root:
+		lines = append(lines, fit("enter to expand", width))
+	case r == nil:
+		lines = append(lines, fit("enter to show the roots", width))
+	case r.err != nil:
+		lines = append(lines, fit("error: "+r.err.Error(), width))
+	default:
+		lines = append(lines, fit(fmt.Sprintf("%d roots, most relevant first:", len(r.roots)), width))
+		for i, root := range r.roots {
+			text := fit(root, width)
+			if i == e.rootIndex && e.focus == rootsPane {
+				text = highlight(text, true)
+			}
+			lines = append(lines, text, fit("    "+strings.TrimSpace(e.sourceLine(root)), width))
+		}
+	}
+	return lines
+}
+
+func (e *Explorer) sourceLine(root string) string {
+	file, line, err := ursonnet.ParseRoot(root)
+	if err != nil {
+		return ""
+	}
+	src, ok := e.sources[file]
+	if !ok {
+		b, _ := os.ReadFile(file)
+		src = strings.Split(string(b), "\n")
+		e.sources[file] = src
+	}
+	if line < 1 || line > len(src) {
+		return ""
+	}
+	return src[line-1]
+}
+
+// fit truncates or pads s to exactly width columns. Tabs are expanded, wide characters are not accounted for.
+func fit(s string, width int) string {
+	s = strings.ReplaceAll(s, "\t", "  ")
+	if n := utf8.RuneCountInString(s); n <= width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	if width <= 0 {
+		return ""
+	}
+	runes := []rune(s)
+	return string(runes[:width-1]) + "…"
+}
+
+func highlight(s string, focused bool) string {
+	if focused {
+		return "\x1b[7m" + s + "\x1b[0m"
+	}
+	return "\x1b[4m" + s + "\x1b[0m"
+}
+
+func clamp(v, lo, hi int) int {
+	if v > hi {
+		v = hi
+	}
+	if v < lo {
+		v = lo
+	}
+	return v
+}
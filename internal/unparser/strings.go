@@ -0,0 +1,114 @@
+/*
+Copyright 2019 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package unparser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// stringEscape does the opposite of the parser's string unescaping, i.e. it
+// produces the body of a quoted string literal from its value.
+func stringEscape(s string, single bool) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); {
+		r, w := utf8.DecodeRuneInString(s[i:])
+		i += w
+		switch r {
+		case '"':
+			if !single {
+				buf.WriteRune('\\')
+			}
+			buf.WriteRune(r)
+		case '\'':
+			if single {
+				buf.WriteRune('\\')
+			}
+			buf.WriteRune(r)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\u0000':
+			buf.WriteString(`\u0000`)
+		default:
+			if r < 0x20 || (r >= 0x7f && r <= 0x9f) {
+				fmt.Fprintf(&buf, `\u%04x`, int(r))
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	return buf.String()
+}
+
+// useSingleQuotes decides which quotes to use for a string literal with the
+// given value, preferring the configured style unless it would require
+// escaping quotes that the other style doesn't.
+func useSingleQuotes(value string, style StringStyle) bool {
+	numSingle := strings.Count(value, "'")
+	numDouble := strings.Count(value, `"`)
+	switch {
+	case numSingle > 0 && numDouble == 0:
+		return false
+	case numDouble > 0 && numSingle == 0:
+		return true
+	}
+	return style == StringStyleSingle
+}
+
+var keywords = map[string]bool{
+	"assert": true, "else": true, "error": true, "false": true, "for": true,
+	"function": true, "if": true, "import": true, "importstr": true,
+	"importbin": true, "in": true, "local": true, "null": true,
+	"tailstrict": true, "then": true, "self": true, "super": true, "true": true,
+}
+
+// IsValidIdentifier reports whether str can be used as a bare field name.
+func IsValidIdentifier(str string) bool {
+	if len(str) == 0 || keywords[str] {
+		return false
+	}
+	for i, r := range str {
+		first := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if !first && (i == 0 || r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Quote returns a string literal for value following the given style.
+func Quote(value string, style StringStyle) string {
+	if style == StringStyleLeave {
+		style = StringStyleDouble
+	}
+	if useSingleQuotes(value, style) {
+		return "'" + stringEscape(value, true) + "'"
+	}
+	return `"` + stringEscape(value, false) + `"`
+}
@@ -20,6 +20,7 @@ package unparser
 import (
 	"bytes"
 	"fmt"
+	"strings"
 
 	"github.com/google/go-jsonnet/ast"
 )
@@ -27,6 +28,14 @@ import (
 type Unparser struct {
 	buf     bytes.Buffer
 	options Options
+	// indent is the nesting level of desugared objects
+	indent int
+}
+
+// New returns an Unparser that honours the given formatting options.
+// The zero Unparser uses the zero Options.
+func New(options Options) *Unparser {
+	return &Unparser{options: options}
 }
 
 func (u *Unparser) write(str string) {
@@ -170,17 +179,79 @@ func (u *Unparser) unparseFieldParams(field ast.ObjectField) {
 	}
 }
 
-func (u *Unparser) unparseDesugaredFields(fields ast.DesugaredObjectFields, crowded bool) {
-	var fs ast.ObjectFields
-	for _, field := range fields {
-		fs = append(fs, ast.ObjectField{
-			Kind:  ast.ObjectFieldStr,
-			Hide:  field.Hide,
-			Expr1: field.Name,
-			Expr2: field.Body,
-		})
+// unparseDesugaredObject prints the locals, asserts and fields of a desugared object.
+// Desugared fields carry no fodder, so when an indentation is configured each of them
+// is put on its own line.
+func (u *Unparser) unparseDesugaredObject(node *ast.DesugaredObject, crowded bool) {
+	multiline := u.options.Indent > 0
+	empty := true
+	u.indent++
+	sep := func() bool {
+		if !empty {
+			u.write(",")
+		}
+		c := !empty || crowded
+		if multiline {
+			u.write("\n")
+			u.write(strings.Repeat(" ", u.indent*u.options.Indent))
+			c = false
+		}
+		empty = false
+		return c
+	}
+
+	for _, bind := range node.Locals {
+		if bind.Variable == "$" {
+			// implicitly bound by the outermost object
+			continue
+		}
+		u.fill(nil, sep(), true)
+		u.write("local ")
+		u.unparseID(bind.Variable)
+		u.write(" =")
+		u.Unparse(bind.Body, true)
+	}
+	for _, a := range node.Asserts {
+		u.fill(nil, sep(), true)
+		u.write("assert")
+		u.Unparse(a, true)
 	}
-	u.unparseFields(fs, crowded)
+	for _, field := range node.Fields {
+		c := sep()
+		lit, isLit := field.Name.(*ast.LiteralString)
+		switch {
+		case isLit && u.options.PrettyFieldNames && IsValidIdentifier(lit.Value):
+			u.fill(lit.Fodder, c, true)
+			u.write(lit.Value)
+		case isLit:
+			u.Unparse(lit, c)
+		default:
+			u.fill(nil, c, true)
+			u.write("[")
+			u.Unparse(field.Name, false)
+			u.write("]")
+		}
+		if field.PlusSuper {
+			u.write("+")
+		}
+		switch field.Hide {
+		case ast.ObjectFieldInherit:
+			u.write(":")
+		case ast.ObjectFieldHidden:
+			u.write("::")
+		case ast.ObjectFieldVisible:
+			u.write(":::")
+		}
+		u.Unparse(field.Body, true)
+	}
+
+	u.indent--
+	if multiline && !empty {
+		u.write(",\n")
+		u.write(strings.Repeat(" ", u.indent*u.options.Indent))
+		return
+	}
+	u.fill(nil, !empty, u.options.PadObjects)
 }
 
 func (u *Unparser) unparseFields(fields ast.ObjectFields, crowded bool) {
@@ -266,7 +337,7 @@ func (u *Unparser) Unparse(expr ast.Node, crowded bool) {
 
 	switch node := expr.(type) {
 	case *ast.Apply:
-		u.Unparse(node.Target, crowded)
+		u.unparseOperand(node.Target, crowded, precedence(node.Target) > precedenceApply)
 		u.fill(node.FodderLeft, false, false)
 		u.write("(")
 		first := true
@@ -347,10 +418,11 @@ func (u *Unparser) Unparse(expr ast.Node, crowded bool) {
 		u.Unparse(node.Rest, true)
 
 	case *ast.Binary:
-		u.Unparse(node.Left, crowded)
+		prec := bopPrecedence[node.Op]
+		u.unparseOperand(node.Left, crowded, precedence(node.Left) > prec)
 		u.fill(node.OpFodder, true, true)
 		u.write(node.Op.String())
-		u.Unparse(node.Right, true)
+		u.unparseOperand(node.Right, true, precedence(node.Right) >= prec)
 
 	case *ast.Conditional:
 		u.write("if")
@@ -389,9 +461,12 @@ func (u *Unparser) Unparse(expr ast.Node, crowded bool) {
 		u.Unparse(node.File, true)
 
 	case *ast.Index:
-		u.Unparse(node.Target, crowded)
+		u.unparseOperand(node.Target, crowded, precedence(node.Target) > precedenceApply)
 		u.fill(node.LeftBracketFodder, false, false) // Can also be DotFodder
-		if node.Id != nil {
+		if lit, ok := node.Index.(*ast.LiteralString); ok && u.options.PrettyFieldNames && IsValidIdentifier(lit.Value) {
+			u.write(".")
+			u.write(lit.Value)
+		} else if node.Id != nil {
 			u.write(".")
 			u.fill(node.RightBracketFodder, false, false) // IdFodder
 			u.unparseID(*node.Id)
@@ -403,7 +478,7 @@ func (u *Unparser) Unparse(expr ast.Node, crowded bool) {
 		}
 
 	case *ast.Slice:
-		u.Unparse(node.Target, crowded)
+		u.unparseOperand(node.Target, crowded, precedence(node.Target) > precedenceApply)
 		u.fill(node.LeftBracketFodder, false, false)
 		u.write("[")
 		if node.BeginIndex != nil {
@@ -425,7 +500,7 @@ func (u *Unparser) Unparse(expr ast.Node, crowded bool) {
 		u.write("]")
 
 	case *ast.InSuper:
-		u.Unparse(node.Index, true)
+		u.unparseOperand(node.Index, crowded, precedence(node.Index) > bopPrecedence[ast.BopIn])
 		u.fill(node.InFodder, true, true)
 		u.write("in")
 		u.fill(node.SuperFodder, true, true)
@@ -469,7 +544,14 @@ func (u *Unparser) Unparse(expr ast.Node, crowded bool) {
 		u.write(node.OriginalString)
 
 	case *ast.LiteralString:
-		switch node.Kind {
+		kind := node.Kind
+		if (kind == ast.StringDouble || kind == ast.StringSingle) && u.options.StringStyle != StringStyleLeave {
+			// Desugared string literals hold the unescaped value,
+			// so they can be requoted in the requested style.
+			u.write(Quote(node.Value, u.options.StringStyle))
+			break
+		}
+		switch kind {
 		case ast.StringDouble:
 			u.write("\"")
 			// The original escape codes are still in the string.
@@ -535,7 +617,7 @@ func (u *Unparser) Unparse(expr ast.Node, crowded bool) {
 
 	case *ast.DesugaredObject:
 		u.write("{")
-		u.unparseDesugaredFields(node.Fields, u.options.PadObjects)
+		u.unparseDesugaredObject(node, u.options.PadObjects)
 		u.write("}")
 
 	case *ast.ObjectComp:
@@ -560,7 +642,10 @@ func (u *Unparser) Unparse(expr ast.Node, crowded bool) {
 	case *ast.SuperIndex:
 		u.write("super")
 		u.fill(node.DotFodder, false, false)
-		if node.Id != nil {
+		if lit, ok := node.Index.(*ast.LiteralString); ok && u.options.PrettyFieldNames && IsValidIdentifier(lit.Value) {
+			u.write(".")
+			u.write(lit.Value)
+		} else if node.Id != nil {
 			u.write(".")
 			u.fill(node.IDFodder, false, false)
 			u.unparseID(*node.Id)
@@ -571,17 +656,80 @@ func (u *Unparser) Unparse(expr ast.Node, crowded bool) {
 			u.write("]")
 		}
 	case *ast.Var:
+		if node.Id == "$std" {
+			// the desugarer's alias for std
+			u.write("std")
+			break
+		}
 		u.unparseID(node.Id)
 
 	case *ast.Unary:
 		u.write(node.Op.String())
-		u.Unparse(node.Expr, false)
+		u.unparseOperand(node.Expr, false, precedence(node.Expr) >= precedenceUnary)
 
 	default:
 		panic(fmt.Sprintf("INTERNAL ERROR: Unknown AST: %T", expr))
 	}
 }
 
+// unparseOperand unparses an operand of an expression, in parentheses if needed.
+// Parentheses are dropped by the desugarer, so they have to be put back
+// according to the precedence of the operand.
+func (u *Unparser) unparseOperand(expr ast.Node, crowded bool, parens bool) {
+	if !parens {
+		u.Unparse(expr, crowded)
+		return
+	}
+	u.fill(nil, crowded, true)
+	u.write("(")
+	u.Unparse(expr, false)
+	u.write(")")
+}
+
+const (
+	precedenceApply = 2
+	precedenceUnary = 4
+	precedenceMax   = 16
+)
+
+var bopPrecedence = map[ast.BinaryOp]int{
+	ast.BopMult:            5,
+	ast.BopDiv:             5,
+	ast.BopPercent:         5,
+	ast.BopPlus:            6,
+	ast.BopMinus:           6,
+	ast.BopShiftL:          7,
+	ast.BopShiftR:          7,
+	ast.BopGreater:         8,
+	ast.BopGreaterEq:       8,
+	ast.BopLess:            8,
+	ast.BopLessEq:          8,
+	ast.BopIn:              8,
+	ast.BopManifestEqual:   9,
+	ast.BopManifestUnequal: 9,
+	ast.BopBitwiseAnd:      10,
+	ast.BopBitwiseXor:      11,
+	ast.BopBitwiseOr:       12,
+	ast.BopAnd:             13,
+	ast.BopOr:              14,
+}
+
+// precedence returns how loosely expr binds, as in the parser: lower binds tighter.
+// Expressions that extend as far right as possible, like `local` or `if`, bind loosest.
+func precedence(expr ast.Node) int {
+	switch node := expr.(type) {
+	case *ast.Binary:
+		return bopPrecedence[node.Op]
+	case *ast.InSuper:
+		return bopPrecedence[ast.BopIn]
+	case *ast.Unary:
+		return precedenceUnary
+	case *ast.Assert, *ast.Conditional, *ast.Error, *ast.Function, *ast.Import, *ast.ImportBin, *ast.ImportStr, *ast.Local:
+		return precedenceMax
+	}
+	return 0
+}
+
 func (u *Unparser) String() string {
 	return u.buf.String()
 }
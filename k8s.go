@@ -0,0 +1,168 @@
+package ursonnet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/google/go-jsonnet"
+)
+
+// Object is a Kubernetes resource found in the output of an entrypoint.
+type Object struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	// Path is the field path of the object in the output, like `$.deployment`.
+	Path string
+	// Value is the decoded JSON object.
+	Value map[string]interface{}
+}
+
+// Address returns the address of the object, `apiVersion/kind/namespace/name`, like `apps/v1/Deployment/ns/foo`.
+// The namespace is left out for objects that don't have one.
+func (o Object) Address() string {
+	parts := []string{o.APIVersion, o.Kind, o.Namespace, o.Name}
+	if o.Namespace == "" {
+		parts = []string{o.APIVersion, o.Kind, o.Name}
+	}
+	return strings.Join(parts, "/")
+}
+
+// Objects returns the Kubernetes objects of a JSON output, walking it the way kubecfg flattens it:
+// values with an apiVersion and a kind are objects, except lists (kinds ending in List, with items) whose items are walked;
+// other objects and arrays are walked, fields in sorted order, and the other values skipped.
+func Objects(output string) ([]Object, error) {
+	v, err := decodeJSON(output)
+	if err != nil {
+		return nil, err
+	}
+	return objectsOf(v), nil
+}
+
+// objectsOf returns the objects of a decoded output; their values are the maps of v.
+func objectsOf(v interface{}) []Object {
+	var res []Object
+	walkObjects(nil, v, &res)
+	return res
+}
+
+func walkObjects(path fieldPath, v interface{}, res *[]Object) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		kind, hasKind := v["kind"].(string)
+		apiVersion, hasAPIVersion := v["apiVersion"].(string)
+		if hasKind && hasAPIVersion {
+			if items, ok := v["items"].([]interface{}); ok && strings.HasSuffix(kind, "List") {
+				walkObjects(path.append(pathElem{Field: "items"}), items, res)
+				return
+			}
+			o := Object{APIVersion: apiVersion, Kind: kind, Path: path.String(), Value: v}
+			if m, ok := v["metadata"].(map[string]interface{}); ok {
+				o.Namespace, _ = m["namespace"].(string)
+				o.Name, _ = m["name"].(string)
+			}
+			*res = append(*res, o)
+			return
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			walkObjects(path.append(pathElem{Field: k}), v[k], res)
+		}
+	case []interface{}:
+		for i, e := range v {
+			walkObjects(path.append(pathElem{Index: i, IsIndex: true}), e, res)
+		}
+	}
+}
+
+// IsAddress reports whether s is an object address, `apiVersion/kind/[namespace/]name` optionally followed by
+// `:` and a relative field path (see AddressFieldPath), rather than a field path or another jsonnet expression.
+func IsAddress(s string) bool {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "$") {
+		return false
+	}
+	addr, rel := splitAddress(s)
+	if _, err := parseFieldPath("$" + rel); err != nil {
+		return false
+	}
+	parts := strings.Split(addr, "/")
+	for _, p := range parts {
+		if p == "" || strings.IndexFunc(p, func(r rune) bool {
+			return !(r == '.' || r == '-' || r == '_' || r == ':' || unicode.IsLetter(r) || unicode.IsDigit(r))
+		}) >= 0 {
+			return false
+		}
+	}
+	// the kind follows the apiVersion, which has a group or not, and starts with an upper case letter
+	isKind := func(p string) bool {
+		return unicode.IsUpper([]rune(p)[0])
+	}
+	switch len(parts) {
+	case 3:
+		return isKind(parts[1])
+	case 4:
+		return isKind(parts[1]) || isKind(parts[2])
+	case 5:
+		return isKind(parts[2])
+	}
+	return false
+}
+
+// AddressFieldPath translates an object address, optionally followed by a field path relative to the object,
+// like `apps/v1/Deployment/ns/foo:.spec.replicas`, into the field path of the value in the JSON output,
+// like `$.deployment.spec.replicas`.
+func AddressFieldPath(output string, address string) (string, error) {
+	addr, rel := splitAddress(strings.TrimSpace(address))
+	if _, err := parseFieldPath("$" + rel); err != nil {
+		return "", fmt.Errorf("bad field path in address %q: %w", address, err)
+	}
+	objs, err := Objects(output)
+	if err != nil {
+		return "", err
+	}
+	var found []Object
+	for _, o := range objs {
+		if o.Address() == addr {
+			found = append(found, o)
+		}
+	}
+	switch {
+	case len(found) == 0:
+		return "", fmt.Errorf("no object %s in the output", addr)
+	case len(found) > 1:
+		return "", fmt.Errorf("%d objects %s in the output, at %s and %s", len(found), addr, found[0].Path, found[1].Path)
+	}
+	return found[0].Path + rel, nil
+}
+
+// splitAddress splits an address at the colon starting the relative field path, if any.
+// Object names may contain colons (e.g. RBAC roles), but not followed by `.` or `[`.
+func splitAddress(s string) (string, string) {
+	for i := 0; i < len(s)-1; i++ {
+		if s[i] == ':' && (s[i+1] == '.' || s[i+1] == '[') {
+			return s[:i], s[i+1:]
+		}
+	}
+	return strings.TrimSuffix(s, ":"), ""
+}
+
+// ResolveAddress returns the field path of an object address (see AddressFieldPath) in the output of
+// the entrypoint filename. Other expressions, like field paths, are returned as they are, without evaluating.
+func ResolveAddress(vm *jsonnet.VM, filename string, address string) (string, error) {
+	if !IsAddress(address) {
+		return address, nil
+	}
+	output, err := Evaluate(vm, filename, "$")
+	if err != nil {
+		return "", err
+	}
+	return AddressFieldPath(output, address)
+}
@@ -0,0 +1,167 @@
+package ursonnet
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+)
+
+func TestIsAddress(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"apps/v1/Deployment/ns/foo", true},
+		{"apps/v1/Deployment/foo", true},
+		{"v1/ConfigMap/ns/foo", true},
+		{"v1/Namespace/prod", true},
+		{" v1/Namespace/prod ", true},
+		{"rbac.authorization.k8s.io/v1/ClusterRole/system:controller:foo", true},
+		{"apps/v1/Deployment/ns/foo:.spec.replicas", true},
+		{`v1/Secret/prod/s:.stringData["password"]`, true},
+		{"v1/ConfigMap/ns/foo:[\"data\"]", true},
+		{"apps/v1/Deployment/ns/foo:", true},
+
+		{"$", false},
+		{"$.deployment.kind", false},
+		{"std.length($.deployment.spec.template.spec.containers)", false},
+		{"($.deployment.kind)", false},
+		{"[$.a, $.b]", false},
+		{"1 + 2", false},
+		{"foo", false},
+		{"a/b", false},
+		{"x/y/z", false},
+		{"v1/configmap/foo", false},
+		{"apps/v1/Deployment/ns/foo/bar", false},
+		{"apps/v1//foo", false},
+		{"v1/Secret/prod/s:.a[", false},
+		{"v1/Secret/prod/s:.$x", false},
+		{"v1/Secret/prod/s :.a", false},
+	}
+	for _, test := range tests {
+		if got := IsAddress(test.s); got != test.want {
+			t.Errorf("IsAddress(%q) = %v, want %v", test.s, got, test.want)
+		}
+	}
+}
+
+func TestSplitAddress(t *testing.T) {
+	tests := []struct {
+		s, addr, rel string
+	}{
+		{"apps/v1/Deployment/ns/foo", "apps/v1/Deployment/ns/foo", ""},
+		{"apps/v1/Deployment/ns/foo:", "apps/v1/Deployment/ns/foo", ""},
+		{"apps/v1/Deployment/ns/foo:.spec.replicas", "apps/v1/Deployment/ns/foo", ".spec.replicas"},
+		{`v1/Secret/prod/s:["data"].a`, "v1/Secret/prod/s", `["data"].a`},
+		{"rbac.authorization.k8s.io/v1/ClusterRole/system:foo", "rbac.authorization.k8s.io/v1/ClusterRole/system:foo", ""},
+		{"rbac.authorization.k8s.io/v1/ClusterRole/system:foo:.rules[0]", "rbac.authorization.k8s.io/v1/ClusterRole/system:foo", ".rules[0]"},
+	}
+	for _, test := range tests {
+		addr, rel := splitAddress(test.s)
+		if addr != test.addr || rel != test.rel {
+			t.Errorf("splitAddress(%q) = %q, %q, want %q, %q", test.s, addr, rel, test.addr, test.rel)
+		}
+	}
+}
+
+const k8sOutput = `{
+  "deployment": {
+    "apiVersion": "apps/v1",
+    "kind": "Deployment",
+    "metadata": {"name": "foo", "namespace": "ns"},
+    "spec": {"replicas": 3}
+  },
+  "list": {
+    "apiVersion": "v1",
+    "kind": "List",
+    "items": [
+      {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "cm", "namespace": "ns"}, "data": {"a.b": "c"}},
+      {"apiVersion": "v1", "kind": "Namespace", "metadata": {"name": "ns"}}
+    ]
+  },
+  "dupes": [
+    {"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "s", "namespace": "ns"}},
+    {"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "s", "namespace": "ns"}}
+  ]
+}`
+
+func TestAddressFieldPath(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+	}{
+		{"apps/v1/Deployment/ns/foo", "$.deployment"},
+		{"apps/v1/Deployment/ns/foo:.spec.replicas", "$.deployment.spec.replicas"},
+		{`apps/v1/Deployment/ns/foo:["spec"].replicas`, `$.deployment["spec"].replicas`},
+		{"v1/ConfigMap/ns/cm:.data", "$.list.items[0].data"},
+		{`v1/ConfigMap/ns/cm:.data["a.b"]`, `$.list.items[0].data["a.b"]`},
+		{"v1/Namespace/ns", "$.list.items[1]"},
+	}
+	for _, test := range tests {
+		got, err := AddressFieldPath(k8sOutput, test.address)
+		if err != nil {
+			t.Errorf("AddressFieldPath(%q): %v", test.address, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("AddressFieldPath(%q) = %q, want %q", test.address, got, test.want)
+		}
+	}
+
+	for _, address := range []string{
+		"apps/v1/Deployment/foo",
+		"apps/v1/Deployment/other/foo",
+		"v1/Secret/ns/s",
+		"apps/v1/Deployment/ns/foo:.spec[",
+	} {
+		if got, err := AddressFieldPath(k8sOutput, address); err == nil {
+			t.Errorf("AddressFieldPath(%q) = %q, want an error", address, got)
+		}
+	}
+}
+
+func TestResolveAddress(t *testing.T) {
+	vm := jsonnet.MakeVM()
+	for _, expr := range []string{
+		"$.deployment.kind",
+		"std.length($.deployment.spec.template.spec.containers)",
+		"($.deployment.kind)",
+	} {
+		got, err := ResolveAddress(vm, "testdata/child.jsonnet", expr)
+		if err != nil || got != expr {
+			t.Errorf("ResolveAddress(%q) = %q, %v, want it unchanged", expr, got, err)
+		}
+	}
+	got, err := ResolveAddress(vm, "testdata/child.jsonnet", "apps/v1/Deployment/foo:.spec.template.metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "$.deployment.spec.template.metadata"; got != want {
+		t.Errorf("ResolveAddress = %q, want %q", got, want)
+	}
+}
+
+func TestObjects(t *testing.T) {
+	const output = `{
+  "config": {
+    "kind": "web",
+    "replicas": 3,
+    "service": {"apiVersion": "v1", "kind": "Service", "metadata": {"name": "web"}}
+  },
+  "list": {"apiVersion": "v1", "kind": "List", "items": [{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "cm"}}]},
+  "versioned": {"apiVersion": "v2", "name": "not an object"}
+}`
+	objs, err := Objects(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, o := range objs {
+		got = append(got, o.Address()+" "+o.Path)
+	}
+	want := []string{"v1/Service/web $.config.service", "v1/ConfigMap/cm $.list.items[0]"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Objects = %q, want %q", got, want)
+	}
+}
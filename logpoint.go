@@ -0,0 +1,71 @@
+package ursonnet
+
+import (
+	"fmt"
+
+	"github.com/google/go-jsonnet"
+	"github.com/kubecfg/ursonnet/internal/unparser"
+)
+
+// Logpoint prints the value of a jsonnet expression every time the field defined at a source location
+// is evaluated. The expression is evaluated in the scope of the field, so it can refer to self, super,
+// $ and to the locals visible there.
+type Logpoint struct {
+	File string
+	Line int
+	Expr string
+}
+
+// ParseLogpoint parses logpoints written as `file:line=expr`.
+func ParseLogpoint(s string) (Logpoint, error) {
+	i := indexAssign(s)
+	if i < 0 {
+		return Logpoint{}, fmt.Errorf("logpoint %q must be written as file:line=expr", s)
+	}
+	file, line, err := ParseRoot(s[:i])
+	if err != nil {
+		return Logpoint{}, fmt.Errorf("bad logpoint location %q: %w", s[:i], err)
+	}
+	return Logpoint{File: file, Line: line, Expr: s[i+1:]}, nil
+}
+
+func (l Logpoint) String() string {
+	return fmt.Sprintf("%s:%d=%s", l.File, l.Line, l.Expr)
+}
+
+// EvaluateWithLogpoints evaluates the jsonnet file identified by filename with the logpoints injected
+// in memory, so no file is modified. The logpoints print like std.trace does, to the VM trace output,
+// as `TRACE: file:line expr = value`.
+func EvaluateWithLogpoints(vm *jsonnet.VM, filename string, logpoints []Logpoint) (string, error) {
+	applied := make([]bool, len(logpoints))
+	res, err := evaluatePatched(vm, filename, "$", func(foundAt, content string) (string, error) {
+		for i, l := range logpoints {
+			if !matchesFile(foundAt, l.File) {
+				continue
+			}
+			var err error
+			if content, err = replaceFieldBody(foundAt, content, l.Line, l.wrap); err != nil {
+				return "", fmt.Errorf("logpoint %s: %w", l, err)
+			}
+			applied[i] = true
+		}
+		return content, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	for i, ok := range applied {
+		if !ok {
+			return "", fmt.Errorf("logpoint %s: file not imported by %s", logpoints[i], filename)
+		}
+	}
+	return res, nil
+}
+
+// wrap traces the logpoint expression before evaluating the field body.
+// The result is kept on one line, so that the lines of the file don't change.
+func (l Logpoint) wrap(body string) string {
+	const v = "__ursonnet_logpoint_"
+	return fmt.Sprintf(`std.trace(%s + (local %s = (%s); if std.isFunction(%s) then "<function>" else std.manifestJsonMinified(%s)), (%s))`,
+		unparser.Quote(l.Expr+" = ", unparser.StringStyleDouble), v, l.Expr, v, v, body)
+}
@@ -0,0 +1,84 @@
+package ursonnet
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+)
+
+func TestReplaceFieldBody(t *testing.T) {
+	const content = `{
+  a: 1,
+  b: { c: 2 },
+  d: [x { e: x } for x in [1]],
+  f: 1, g: 2,
+  h: 'x',
+}
+`
+	tests := []struct {
+		line int
+		want string // the new line, or the error
+	}{
+		{2, "  a: <1>,"},
+		{3, "  b: <{ c: 2 }>,"},
+		{4, "  d: <[x { e: x } for x in [1]]>,"},
+		{5, "error: 2 fields defined at f.jsonnet:5"},
+		{6, "  h: <'x'>,"},
+		{7, "error: no field defined at f.jsonnet:7"},
+	}
+	for _, test := range tests {
+		got, err := replaceFieldBody("f.jsonnet", content, test.line, func(body string) string {
+			return "<" + body + ">"
+		})
+		if err != nil {
+			if "error: "+err.Error() != test.want {
+				t.Errorf("line %d: %v, want %s", test.line, err, test.want)
+			}
+			continue
+		}
+		if line := strings.Split(got, "\n")[test.line-1]; line != test.want {
+			t.Errorf("line %d: got %q, want %q", test.line, line, test.want)
+		}
+	}
+}
+
+func TestEvaluateWithLogpoints(t *testing.T) {
+	tests := []struct {
+		logpoint string
+		want     string
+	}{
+		{
+			logpoint: "testdata/common.libsonnet:22=self.requests",
+			want:     `TRACE: testdata/common.libsonnet:22 self.requests = {"cpu":"2","memory":"2Gi"}`,
+		},
+		{
+			logpoint: "testdata/common.libsonnet:27=std.objectFields(self.containers_)",
+			want:     `TRACE: testdata/common.libsonnet:27 std.objectFields(self.containers_) = ["foo"]`,
+		},
+	}
+	for _, test := range tests {
+		l, err := ParseLogpoint(test.logpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vm := jsonnet.MakeVM()
+		var trace strings.Builder
+		vm.SetTraceOut(&trace)
+		got, err := EvaluateWithLogpoints(vm, "testdata/child.jsonnet", []Logpoint{l})
+		if err != nil {
+			t.Errorf("%s: %v", test.logpoint, err)
+			continue
+		}
+		want, err := jsonnet.MakeVM().EvaluateFile("testdata/child.jsonnet")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: the logpoint changed the output:\n%s", test.logpoint, got)
+		}
+		if !strings.Contains(trace.String(), test.want+"\n") {
+			t.Errorf("%s: traced %q, want %q", test.logpoint, trace.String(), test.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package ursonnet
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/kubecfg/ursonnet/internal/unparser"
+)
+
+// pathElem is one step of a field path: either an object field or an array index.
+type pathElem struct {
+	Field   string
+	Index   int
+	IsIndex bool
+}
+
+// fieldPath is a parsed `$`-rooted field path such as `$.a.b[0]["c-d"]`.
+type fieldPath []pathElem
+
+// parseFieldPath parses a field path made only of `.id`, `[N]`, `["str"]` and `['str']` steps.
+func parseFieldPath(s string) (fieldPath, error) {
+	rest := strings.TrimSpace(s)
+	if !strings.HasPrefix(rest, "$") {
+		return nil, fmt.Errorf("field path %q must start with $", s)
+	}
+	rest = rest[1:]
+
+	var res fieldPath
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			n := strings.IndexAny(rest, ".[")
+			if n < 0 {
+				n = len(rest)
+			}
+			id := rest[:n]
+			if !unparser.IsValidIdentifier(id) {
+				return nil, fmt.Errorf("bad field name %q in field path %q", id, s)
+			}
+			res = append(res, pathElem{Field: id})
+			rest = rest[n:]
+		case '[':
+			if len(rest) > 1 && (rest[1] == '"' || rest[1] == '\'') {
+				n := quotedLen(rest[1:])
+				if n < 0 || !strings.HasPrefix(rest[1+n:], "]") {
+					return nil, fmt.Errorf("bad quoted field name in field path %q", s)
+				}
+				name, err := unquote(rest[1 : 1+n])
+				if err != nil {
+					return nil, fmt.Errorf("bad quoted field name %s in field path %q", rest[1:1+n], s)
+				}
+				res = append(res, pathElem{Field: name})
+				rest = rest[n+2:]
+				continue
+			}
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated [ in field path %q", s)
+			}
+			i, err := strconv.Atoi(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("bad array index %q in field path %q", rest[1:end], s)
+			}
+			res = append(res, pathElem{Index: i, IsIndex: true})
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected %q in field path %q", rest[0], s)
+		}
+	}
+	return res, nil
+}
+
+// quotedLen returns the length of the string literal at the start of s, quotes included, or -1 if it's unterminated.
+func quotedLen(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case s[0]:
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// unquote returns the value of a jsonnet string literal.
+func unquote(lit string) (string, error) {
+	a, err := jsonnet.SnippetToAST("<field path>", lit)
+	if err != nil {
+		return "", err
+	}
+	str, ok := a.(*ast.LiteralString)
+	if !ok {
+		return "", fmt.Errorf("%s is not a string", lit)
+	}
+	return str.Value, nil
+}
+
+// append returns a new path with e appended, leaving p untouched.
+func (p fieldPath) append(e pathElem) fieldPath {
+	return append(append(fieldPath{}, p...), e)
+}
+
+func (p fieldPath) String() string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, e := range p {
+		switch {
+		case e.IsIndex:
+			fmt.Fprintf(&b, "[%d]", e.Index)
+		case unparser.IsValidIdentifier(e.Field):
+			b.WriteString(".")
+			b.WriteString(e.Field)
+		default:
+			fmt.Fprintf(&b, "[%s]", unparser.Quote(e.Field, unparser.StringStyleDouble))
+		}
+	}
+	return b.String()
+}
+
+// lookup returns the value at the path in a decoded JSON value, if there is one.
+func (p fieldPath) lookup(v interface{}) (interface{}, bool) {
+	for _, e := range p {
+		switch c := v.(type) {
+		case map[string]interface{}:
+			if e.IsIndex {
+				return nil, false
+			}
+			var ok bool
+			if v, ok = c[e.Field]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			if !e.IsIndex || e.Index < 0 || e.Index >= len(c) {
+				return nil, false
+			}
+			v = c[e.Index]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// HasField reports whether the JSON output has a value at the field path.
+func HasField(output string, path string) (bool, error) {
+	p, err := parseFieldPath(path)
+	if err != nil {
+		return false, err
+	}
+	v, err := decodeJSON(output)
+	if err != nil {
+		return false, err
+	}
+	_, ok := p.lookup(v)
+	return ok, nil
+}
+
+// FieldPathOf returns the field path, like `$.a["b-c"][0]`, of the value found in the output
+// by following the given field names (strings) and array indices (ints).
+func FieldPathOf(elems ...interface{}) string {
+	var p fieldPath
+	for _, e := range elems {
+		switch e := e.(type) {
+		case int:
+			p = append(p, pathElem{Index: e, IsIndex: true})
+		default:
+			p = append(p, pathElem{Field: fmt.Sprint(e)})
+		}
+	}
+	return p.String()
+}
@@ -0,0 +1,81 @@
+package ursonnet
+
+import "testing"
+
+func TestParseFieldPath(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"$", "$"},
+		{"$.a.b", "$.a.b"},
+		{" $.a[0].b ", "$.a[0].b"},
+		{`$["a"]`, "$.a"},
+		{`$['a']`, "$.a"},
+		{`$["c-d"]`, `$["c-d"]`},
+		{`$['c-d'][12]`, `$["c-d"][12]`},
+		{`$["a.b"].c`, `$["a.b"].c`},
+		{`$["a]b"]`, `$["a]b"]`},
+		{`$["a\"b"]`, `$['a"b']`},
+		{`$['it\'s']`, `$["it's"]`},
+		{`$["a\\b"]`, `$["a\\b"]`},
+		{`$["line\n"]`, `$["line\n"]`},
+		{`$["local"]`, `$["local"]`},
+		{`$[""]`, `$[""]`},
+	}
+	for _, test := range tests {
+		p, err := parseFieldPath(test.in)
+		if err != nil {
+			t.Errorf("parseFieldPath(%q): %v", test.in, err)
+			continue
+		}
+		if got := p.String(); got != test.want {
+			t.Errorf("parseFieldPath(%q).String() = %q, want %q", test.in, got, test.want)
+			continue
+		}
+		again, err := parseFieldPath(p.String())
+		if err != nil {
+			t.Errorf("parseFieldPath(%q): %v", p.String(), err)
+			continue
+		}
+		if again.String() != p.String() || len(again) != len(p) {
+			t.Errorf("%q doesn't round-trip: got %q", p.String(), again.String())
+		}
+	}
+}
+
+func TestParseFieldPathErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"a.b",
+		"$.",
+		"$.a-b",
+		"$.local",
+		"$[x]",
+		"$[0",
+		`$["a"`,
+		`$["a]`,
+		`$["a"x]`,
+		"$a",
+	} {
+		if p, err := parseFieldPath(in); err == nil {
+			t.Errorf("parseFieldPath(%q) = %q, want an error", in, p)
+		}
+	}
+}
+
+func TestFieldPathOf(t *testing.T) {
+	tests := []struct {
+		elems []interface{}
+		want  string
+	}{
+		{nil, "$"},
+		{[]interface{}{"a", 0, "b-c"}, `$.a[0]["b-c"]`},
+		{[]interface{}{"metadata", "labels", "app.kubernetes.io/name"}, `$.metadata.labels["app.kubernetes.io/name"]`},
+	}
+	for _, test := range tests {
+		if got := FieldPathOf(test.elems...); got != test.want {
+			t.Errorf("FieldPathOf(%v) = %q, want %q", test.elems, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,410 @@
+package ursonnet
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/google/go-jsonnet/toolutils"
+	"github.com/kubecfg/ursonnet/transformast"
+)
+
+// The probes below instrument the whole evaluation of an entrypoint. Every object field with a literal
+// name x gets a hidden sibling field, named locMarkerPrefix+x, whose value is the location of x.
+// Since the marker is defined (and thus overridden) exactly where x is, looking up the marker in an
+// object returns the location of the layer that provides the field, following the actual inheritance chain.
+const locMarkerPrefix = "__ursonnet_loc_"
+
+const (
+	defHelper = `function(t, name) std.trace("uRsOnNeT:def:" + (
+  if std.isObject(t) && std.objectHasAll(t, "__ursonnet_loc_" + name) then t["__ursonnet_loc_" + name] else ""
+), t[name])`
+	superDefHelper = `function(loc, v) std.trace("uRsOnNeT:def:" + loc, v)`
+	probeHelper    = `function(v) if std.trace("uRsOnNeT:begin:", true) then std.trace("uRsOnNeT:end:" + (
+  if std.isFunction(v) then "<function>" else std.manifestJsonMinified(v)
+), v) else v`
+	lensHelper = `function(o, name, loc) std.trace("uRsOnNeT:lens:" + loc + "=" + (
+  if std.objectHasAll(o, "__ursonnet_loc_" + name) then o["__ursonnet_loc_" + name] else loc
+), true)`
+)
+
+// ProbeOpt is an option for Definitions, Probe and Overrides.
+type ProbeOpt func(opts *probeOptions)
+
+type probeOptions struct{ overlay map[string]string }
+
+// Overlay makes the probes use the given contents instead of the files on disk,
+// e.g. for editor buffers with unsaved changes. Keys are file paths.
+func Overlay(files map[string]string) ProbeOpt {
+	return func(opts *probeOptions) {
+		opts.overlay = files
+	}
+}
+
+// Definitions returns the locations of the fields that the field access (like self.x, super.x or $.a.b)
+// at line:column in file resolves to, when evaluating the jsonnet file identified by entrypoint.
+// Unlike a static analysis this follows the inheritance chain of the actual objects, so self.x resolves
+// to the last layer that defines x. If the access is evaluated for several objects, there may be several
+// definitions. Locations are "file:line" strings like the ones returned by Roots.
+func Definitions(vm *jsonnet.VM, entrypoint, file string, line, column int, opts ...ProbeOpt) ([]string, error) {
+	traces, err := probeEvaluate(vm, entrypoint, file, opts, false, func(src ast.Node, foundAt string) error {
+		access := fieldAccessAt(src, foundAt, ast.Location{Line: line, Column: column})
+		if access == nil {
+			return fmt.Errorf("no field access at %s:%d:%d", file, line, column)
+		}
+		var probe ast.Node
+		switch a := access.(type) {
+		case *ast.Index:
+			helper, err := parseHelper(defHelper)
+			if err != nil {
+				return err
+			}
+			probe = apply(helper, a.Target, a.Index)
+		case *ast.SuperIndex:
+			helper, err := parseHelper(superDefHelper)
+			if err != nil {
+				return err
+			}
+			marker := &ast.Binary{Left: &ast.LiteralString{Value: locMarkerPrefix}, Op: ast.BopPlus, Right: a.Index}
+			loc := &ast.Conditional{
+				Cond:        &ast.InSuper{Index: marker},
+				BranchTrue:  &ast.SuperIndex{Index: marker},
+				BranchFalse: &ast.LiteralString{Value: ""},
+			}
+			probe = apply(helper, loc, a)
+		}
+		return replaceNode(src, access, probe)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	seen := map[string]bool{}
+	for _, t := range traces {
+		if loc := strings.TrimPrefix(t, "def:"); loc != t && loc != "" && !seen[loc] {
+			seen[loc] = true
+			res = append(res, strings.TrimPrefix(loc, "+"))
+		}
+	}
+	return res, nil
+}
+
+// ProbeResult is a value taken by a probed expression during the evaluation, along with its roots.
+type ProbeResult struct {
+	// Value is the JSON value, or "<function>".
+	Value string
+	// Roots are the "file:line" locations of the fields evaluated in order to compute the value.
+	Roots []string
+}
+
+// Probe evaluates the jsonnet file identified by entrypoint and reports the values taken by the expression
+// at line:column in file, which is either a field access (like self.x) or a field, if line:column is on
+// its name. Values are reported once per distinct value, in evaluation order.
+//
+// Roots are collected like Roots does, but only fields that the expression evaluates first are reported:
+// fields whose value was already computed earlier in the evaluation are not evaluated again.
+func Probe(vm *jsonnet.VM, entrypoint, file string, line, column int, opts ...ProbeOpt) ([]ProbeResult, error) {
+	traces, err := probeEvaluate(vm, entrypoint, file, opts, true, func(src ast.Node, foundAt string) error {
+		pos := ast.Location{Line: line, Column: column}
+		helper, err := parseHelper(probeHelper)
+		if err != nil {
+			return err
+		}
+		if access := fieldAccessAt(src, foundAt, pos); access != nil {
+			return replaceNode(src, access, apply(helper, access))
+		}
+		if f := fieldNameAt(src, foundAt, pos); f != nil {
+			f.Body = apply(helper, f.Body)
+			return nil
+		}
+		return fmt.Errorf("no field or field access at %s:%d:%d", file, line, column)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		res  []ProbeResult
+		open []*ProbeResult
+		seen = map[string]bool{}
+	)
+	for _, t := range traces {
+		switch {
+		case t == "begin:":
+			open = append(open, &ProbeResult{})
+		case strings.HasPrefix(t, "end:") && len(open) > 0:
+			r := open[len(open)-1]
+			open = open[:len(open)-1]
+			r.Value = strings.TrimPrefix(t, "end:")
+			reverse(r.Roots)
+			if key := fmt.Sprint(r.Value, r.Roots); !seen[key] {
+				seen[key] = true
+				res = append(res, *r)
+			}
+		case strings.HasPrefix(t, "field:"):
+			for _, r := range open {
+				if root := strings.TrimPrefix(t, "field:"); !contains(r.Roots, root) {
+					r.Roots = append(r.Roots, root)
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+// Overrides evaluates the jsonnet file identified by entrypoint and returns the fields defined in file
+// which are overridden by a later layer in the objects they end up in. Keys are the "file:line" locations
+// of the fields in file, values the locations of the fields overriding them. A location starting with "+"
+// is a field that extends the overridden field with `+:` rather than replacing it.
+func Overrides(vm *jsonnet.VM, entrypoint, file string, opts ...ProbeOpt) (map[string][]string, error) {
+	traces, err := probeEvaluate(vm, entrypoint, file, opts, false, func(src ast.Node, foundAt string) error {
+		helper, err := parseHelper(lensHelper)
+		if err != nil {
+			return err
+		}
+		walkFile(src, foundAt, func(a ast.Node) {
+			o, ok := a.(*ast.DesugaredObject)
+			if !ok {
+				return
+			}
+			for _, f := range o.Fields {
+				if name, ok := f.Name.(*ast.LiteralString); ok {
+					loc := &ast.LiteralString{Value: fmt.Sprintf("%s:%d", foundAt, f.LocRange.Begin.Line)}
+					o.Asserts = append(o.Asserts, apply(helper, &ast.Self{}, &ast.LiteralString{Value: name.Value}, loc))
+				}
+			}
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := map[string][]string{}
+	for _, t := range traces {
+		lens := strings.TrimPrefix(t, "lens:")
+		if lens == t {
+			continue
+		}
+		field, by, _ := strings.Cut(lens, "=")
+		if strings.TrimPrefix(by, "+") != field && !contains(res[field], by) {
+			res[field] = append(res[field], by)
+		}
+	}
+	for _, v := range res {
+		sort.Strings(v)
+	}
+	return res, nil
+}
+
+// probeEvaluate evaluates entrypoint after letting instrument modify the AST of file, and returns the
+// messages of the traces emitted by the probes, without the "uRsOnNeT:" prefix. If roots is true,
+// fields are traced like in Roots and reported as "field:file:line" messages.
+func probeEvaluate(vm *jsonnet.VM, entrypoint, file string, opts []ProbeOpt, roots bool, instrument func(src ast.Node, foundAt string) error) ([]string, error) {
+	var opt probeOptions
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	root, err := jsonnet.SnippetToAST(ursonnetTraceTag, fmt.Sprintf("import %q", entrypoint))
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]ast.Node{}
+	root, err = expandImports(vm, root, files, func(foundAt, content string) (string, error) {
+		for f, c := range opt.overlay {
+			if matchesFile(foundAt, f) {
+				return c, nil
+			}
+		}
+		return content, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var foundAt string
+	for f := range files {
+		if matchesFile(file, f) {
+			foundAt = f
+		}
+	}
+	if foundAt == "" {
+		return nil, fmt.Errorf("%s is not imported by %s", file, entrypoint)
+	}
+	if err := instrument(files[foundAt], foundAt); err != nil {
+		return nil, err
+	}
+
+	if roots {
+		if err := injectTrace(root, map[ast.Node]bool{}); err != nil {
+			return nil, err
+		}
+	} else {
+		addStdFreeVariables(root, map[ast.Node]bool{})
+	}
+	addLocMarkers(root, map[ast.Node]bool{})
+
+	var traceOut bytes.Buffer
+	vm.SetTraceOut(&traceOut)
+	if _, err := vm.Evaluate(root); err != nil {
+		return nil, err
+	}
+
+	var res []string
+	scanner := bufio.NewScanner(&traceOut)
+	scanner.Buffer(nil, len(traceOut.Bytes())+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, " "+ursonnetTraceTag+":"); i >= 0 {
+			res = append(res, line[i+len(ursonnetTraceTag)+2:])
+		} else if roots && strings.HasSuffix(line, " "+ursonnetTraceTag) {
+			res = append(res, "field:"+strings.TrimSuffix(strings.TrimPrefix(line, "TRACE: "), " "+ursonnetTraceTag))
+		}
+	}
+	return res, scanner.Err()
+}
+
+// addLocMarkers adds the hidden location marker field next to every field with a literal name.
+func addLocMarkers(a ast.Node, seen map[ast.Node]bool) {
+	if seen[a] {
+		return
+	}
+	seen[a] = true
+
+	for _, c := range toolutils.Children(a) {
+		addLocMarkers(c, seen)
+	}
+	if o, ok := a.(*ast.DesugaredObject); ok {
+		for _, f := range o.Fields {
+			name, ok := f.Name.(*ast.LiteralString)
+			if !ok || strings.HasPrefix(name.Value, locMarkerPrefix) {
+				continue
+			}
+			loc := fmt.Sprintf("%s:%d", f.LocRange.FileName, f.LocRange.Begin.Line)
+			if f.PlusSuper {
+				loc = "+" + loc
+			}
+			o.Fields = append(o.Fields, ast.DesugaredObjectField{
+				Hide: ast.ObjectFieldHidden,
+				Name: &ast.LiteralString{Value: locMarkerPrefix + name.Value},
+				Body: &ast.LiteralString{Value: loc},
+			})
+		}
+	}
+}
+
+// fieldAccessAt returns the innermost field access with a literal field name (like self.x, super.x
+// or $.a.b) that contains pos, excluding accesses to std.
+func fieldAccessAt(src ast.Node, foundAt string, pos ast.Location) ast.Node {
+	var res ast.Node
+	walkFile(src, foundAt, func(a ast.Node) {
+		var index ast.Node
+		switch a := a.(type) {
+		case *ast.Index:
+			if v, ok := a.Target.(*ast.Var); ok && (v.Id == "std" || v.Id == "$std") {
+				return
+			}
+			index = a.Index
+		case *ast.SuperIndex:
+			index = a.Index
+		default:
+			return
+		}
+		if _, ok := index.(*ast.LiteralString); ok && inRange(a.Loc(), pos) {
+			res = a // walkFile visits outer accesses first
+		}
+	})
+	return res
+}
+
+// fieldNameAt returns the innermost field whose definition contains pos before the beginning of its body.
+func fieldNameAt(src ast.Node, foundAt string, pos ast.Location) *ast.DesugaredObjectField {
+	var res *ast.DesugaredObjectField
+	walkFile(src, foundAt, func(a ast.Node) {
+		o, ok := a.(*ast.DesugaredObject)
+		if !ok {
+			return
+		}
+		for i := range o.Fields {
+			f := &o.Fields[i]
+			if !inRange(&f.LocRange, pos) {
+				continue
+			}
+			if body := f.Body.Loc(); body != nil && body.Begin.Line != 0 && !before(pos, body.Begin) {
+				continue
+			}
+			res = f // walkFile visits outer objects first
+		}
+	})
+	return res
+}
+
+// walkFile visits the nodes of the AST of the file found at foundAt, parents first,
+// without descending into the ASTs of the files it imports.
+func walkFile(a ast.Node, foundAt string, visit func(ast.Node)) {
+	if a == nil {
+		return
+	}
+	if f := a.Loc().FileName; f != "" && f != foundAt {
+		return
+	}
+	visit(a)
+	for _, c := range toolutils.Children(a) {
+		walkFile(c, foundAt, visit)
+	}
+}
+
+// replaceNode replaces the node old, which must not be the root, with new.
+func replaceNode(root, old, new ast.Node) error {
+	_, err := transformast.Transform(root, func(node ast.Node) (ast.Node, error) {
+		if node == old {
+			return new, nil
+		}
+		return node, nil
+	})
+	return err
+}
+
+// parseHelper parses one of the helper functions used by the probes.
+func parseHelper(code string) (ast.Node, error) {
+	return jsonnet.SnippetToAST("<ursonnet>", code)
+}
+
+// apply builds a call to fn. The evaluator captures the environment of the arguments according to the
+// free variables of the call, so these are set to the ones of the arguments.
+func apply(fn ast.Node, args ...ast.Node) ast.Node {
+	var positional []ast.CommaSeparatedExpr
+	for _, a := range args {
+		positional = append(positional, ast.CommaSeparatedExpr{Expr: a})
+	}
+	res := &ast.Apply{Target: fn, Arguments: ast.Arguments{Positional: positional}}
+	for _, a := range append(args, fn) {
+		for _, v := range a.FreeVariables() {
+			addFreeVariable(v, res)
+		}
+	}
+	return res
+}
+
+// inRange reports whether the range r contains the location pos.
+func inRange(r *ast.LocationRange, pos ast.Location) bool {
+	return r != nil && r.Begin.Line != 0 && !before(pos, r.Begin) && !before(r.End, pos)
+}
+
+// before reports whether the location a comes strictly before b.
+func before(a, b ast.Location) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+func contains(s []string, v string) bool {
+	for _, i := range s {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
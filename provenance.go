@@ -0,0 +1,175 @@
+package ursonnet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// StatementType and ProvenanceType identify in-toto statements with a SLSA provenance predicate.
+	StatementType  = "https://in-toto.io/Statement/v1"
+	ProvenanceType = "https://slsa.dev/provenance/v1"
+	// BuildType identifies evaluations of jsonnet entrypoints in provenance statements.
+	BuildType = "https://github.com/kubecfg/ursonnet/evaluation/v1"
+)
+
+// Statement is an in-toto statement about the output of an entrypoint, with a SLSA provenance predicate.
+type Statement struct {
+	Type          string               `json:"_type"`
+	Subject       []ResourceDescriptor `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     Provenance           `json:"predicate"`
+}
+
+// ResourceDescriptor describes a file or a value by its digest.
+type ResourceDescriptor struct {
+	Name        string                 `json:"name"`
+	Digest      map[string]string      `json:"digest"`
+	Annotations map[string]interface{} `json:"annotations,omitempty"`
+}
+
+// Provenance is a SLSA provenance predicate.
+type Provenance struct {
+	BuildDefinition BuildDefinition `json:"buildDefinition"`
+	RunDetails      RunDetails      `json:"runDetails"`
+}
+
+type BuildDefinition struct {
+	BuildType            string               `json:"buildType"`
+	ExternalParameters   Parameters           `json:"externalParameters"`
+	ResolvedDependencies []ResourceDescriptor `json:"resolvedDependencies"`
+}
+
+type RunDetails struct {
+	Builder Builder `json:"builder"`
+}
+
+type Builder struct {
+	ID string `json:"id"`
+}
+
+// Parameters are the inputs of an evaluation besides the source files.
+type Parameters struct {
+	Entrypoint string         `json:"entrypoint"`
+	ExtVars    map[string]Var `json:"extVars,omitempty"`
+	TLAs       map[string]Var `json:"tlas,omitempty"`
+	// Files are files read by the vars, e.g. with --ext-code-file; they are resolved dependencies too.
+	Files []string `json:"-"`
+}
+
+// Var is the value of an ext var or top-level argument: a string or jsonnet code.
+type Var struct {
+	Code  bool   `json:"code,omitempty"`
+	Value string `json:"value"`
+	// File is the file the value was read from, e.g. with --ext-str-file.
+	File string `json:"file,omitempty"`
+}
+
+// NewStatement returns a provenance statement for the output of the entrypoint params.Entrypoint.
+// The subjects are the JSON output, as printed by jsonnet, and each of its Kubernetes objects, annotated
+// with its field path and the source files of its values. The resolved dependencies are the source files
+// with their digests. File names are relative to the current directory when possible.
+func NewStatement(c *Cache, params Parameters) (*Statement, error) {
+	filename := params.Entrypoint
+	output, err := c.Evaluate(filename, "$")
+	if err != nil {
+		return nil, err
+	}
+	blame, err := c.Blame(filename)
+	if err != nil {
+		return nil, err
+	}
+	sources, err := c.Sources(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	subjects := []ResourceDescriptor{{Name: filename, Digest: digest([]byte(output))}}
+	objs, err := Objects(output)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range objs {
+		files := map[string]bool{}
+		for path, roots := range blame {
+			if path != o.Path && !nestedIn(path, o.Path) {
+				continue
+			}
+			for _, r := range roots {
+				if file, _, err := ParseRoot(r); err == nil {
+					files[relPath(file)] = true
+				}
+			}
+		}
+		subjects = append(subjects, ResourceDescriptor{
+			Name:        o.Address(),
+			Digest:      digest([]byte(toJSON(o.Value))),
+			Annotations: map[string]interface{}{"path": o.Path, "sources": sortedKeys(files)},
+		})
+	}
+
+	var deps []ResourceDescriptor
+	seen := map[string]bool{}
+	for _, f := range append(sources, params.Files...) {
+		name := relPath(f)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		content, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		deps = append(deps, ResourceDescriptor{Name: name, Digest: digest(content)})
+	}
+	sort.Slice(deps, func(i, j int) bool { return deps[i].Name < deps[j].Name })
+
+	return &Statement{
+		Type:          StatementType,
+		Subject:       subjects,
+		PredicateType: ProvenanceType,
+		Predicate: Provenance{
+			BuildDefinition: BuildDefinition{
+				BuildType:            BuildType,
+				ExternalParameters:   params,
+				ResolvedDependencies: deps,
+			},
+			RunDetails: RunDetails{Builder: Builder{ID: "https://github.com/kubecfg/ursonnet"}},
+		},
+	}, nil
+}
+
+func digest(b []byte) map[string]string {
+	sum := sha256.Sum256(b)
+	return map[string]string{"sha256": hex.EncodeToString(sum[:])}
+}
+
+// relPath returns the path of file relative to the current directory, if it's not outside of it.
+func relPath(file string) string {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return file
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return file
+	}
+	rel, err := filepath.Rel(wd, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(abs)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,206 @@
+package ursonnet
+
+import (
+	"sort"
+	"sync"
+)
+
+// Redacted replaces the values influenced by secrets.
+const Redacted = "<redacted>"
+
+// Source is an ext var or top-level argument influencing output values.
+type Source struct {
+	Kind InputKind `json:"kind"`
+	Name string    `json:"name"`
+	// Secret is set for the sources marked as secret.
+	Secret bool `json:"secret,omitempty"`
+}
+
+// Influence maps the output leaves of filename to the ext vars and top-level arguments that influence them,
+// sorted by kind and name. Sources named in secrets (as ext vars or top-level arguments) are marked as secret.
+func Influence(c *Cache, filename string, secrets []string) (map[string][]Source, error) {
+	inputs, err := Inputs(c, filename)
+	if err != nil {
+		return nil, err
+	}
+	secret := map[string]bool{}
+	for _, s := range secrets {
+		secret[s] = true
+	}
+	res := map[string][]Source{}
+	for _, in := range inputs {
+		if in.Kind != InputExtVar && in.Kind != InputTLA {
+			continue
+		}
+		for _, p := range in.Affects {
+			res[p] = append(res[p], Source{Kind: in.Kind, Name: in.Name, Secret: secret[in.Name]})
+		}
+	}
+	for _, sources := range res {
+		sort.Slice(sources, func(i, j int) bool {
+			if sources[i].Kind != sources[j].Kind {
+				return sources[i].Kind < sources[j].Kind
+			}
+			return sources[i].Name < sources[j].Name
+		})
+	}
+	return res, nil
+}
+
+// Redactor redacts the output values influenced by secret ext vars and top-level arguments. The roots of the
+// output leaves are only computed for the paths asked about, and the leaves whose roots can't be computed are
+// redacted. A nil Redactor redacts nothing.
+type Redactor struct {
+	c        *Cache
+	filename string
+	secrets  map[string]bool
+
+	mu      sync.Mutex
+	output  interface{}
+	leaves  map[string]bool
+	sources map[string]*source
+}
+
+// NewRedactor returns a Redactor for the output of filename, or nil if there are no secrets.
+func NewRedactor(c *Cache, filename string, secrets []string) (*Redactor, error) {
+	if len(secrets) == 0 {
+		return nil, nil
+	}
+	out, err := c.Evaluate(filename, "$")
+	if err != nil {
+		return nil, err
+	}
+	output, err := decodeJSON(out)
+	if err != nil {
+		return nil, err
+	}
+	r := &Redactor{c: c, filename: filename, secrets: map[string]bool{}, output: output, leaves: map[string]bool{}, sources: map[string]*source{}}
+	for _, s := range secrets {
+		r.secrets[s] = true
+	}
+	return r, nil
+}
+
+// Secret reports whether the value at the field path is influenced by a secret, itself or a value nested in it.
+// Paths absent from the output are secret, and so are expressions that aren't field paths if their roots are.
+func (r *Redactor) Secret(path string) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, err := parseFieldPath(path)
+	if err != nil {
+		roots, err := r.c.Roots(r.filename, path)
+		return err != nil || r.secretRoots(roots)
+	}
+	v, ok := p.lookup(r.output)
+	if !ok {
+		return true
+	}
+	var secret bool
+	walkLeaves(p, v, func(p fieldPath, _ interface{}) interface{} {
+		secret = secret || r.secretLeaf(p)
+		return nil
+	})
+	return secret
+}
+
+// Value returns the JSON value found at the field path with the leaves influenced by secrets replaced by Redacted.
+// Values that aren't JSON, e.g. empty values of absent fields, are returned as they are.
+func (r *Redactor) Value(path string, value string) string {
+	if !r.Secret(path) {
+		return value
+	}
+	p, err := parseFieldPath(path)
+	if err != nil {
+		return toJSON(Redacted)
+	}
+	v, err := decodeJSON(value)
+	if err != nil {
+		return value
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return toJSON(walkLeaves(p, v, func(p fieldPath, v interface{}) interface{} {
+		if r.secretLeaf(p) {
+			return Redacted
+		}
+		return v
+	}))
+}
+
+// Output returns the JSON output with the leaves influenced by secrets replaced by Redacted.
+func (r *Redactor) Output(output string) string {
+	return r.Value("$", output)
+}
+
+// secretLeaf reports whether the output leaf at p is absent or influenced by a secret.
+func (r *Redactor) secretLeaf(p fieldPath) bool {
+	if _, ok := p.lookup(r.output); !ok {
+		return true
+	}
+	path := p.String()
+	secret, ok := r.leaves[path]
+	if !ok {
+		roots, err := r.c.Roots(r.filename, path)
+		secret = err != nil || r.secretRoots(roots)
+		r.leaves[path] = secret
+	}
+	return secret
+}
+
+// secretRoots reports whether one of the roots reads a secret ext var or is a secret top-level argument.
+func (r *Redactor) secretRoots(roots []string) bool {
+	for _, root := range roots {
+		file, line, column, err := parseRootColumn(root)
+		if err != nil {
+			return true
+		}
+		src, ok := r.sources[file]
+		if !ok {
+			r.c.mu.Lock()
+			vm := r.c.vm
+			r.c.mu.Unlock()
+			src, _ = loadSource(vm, "", file) // e.g. fields defined in the query itself
+			r.sources[file] = src
+		}
+		if src == nil {
+			continue
+		}
+		for _, name := range src.extVarsAt(line) {
+			if r.secrets[name] {
+				return true
+			}
+		}
+		if p := src.parameterAt(line, column); p != nil && r.secrets[string(p.Name)] {
+			return true
+		}
+	}
+	return false
+}
+
+// walkLeaves returns a copy of the JSON value v found at path with its scalars, empty objects and empty arrays
+// replaced by what f returns for them.
+func walkLeaves(path fieldPath, v interface{}, f func(fieldPath, interface{}) interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) > 0 {
+			res := map[string]interface{}{}
+			for k, e := range v {
+				res[k] = walkLeaves(path.append(pathElem{Field: k}), e, f)
+			}
+			return res
+		}
+	case []interface{}:
+		if len(v) > 0 {
+			res := make([]interface{}, len(v))
+			for i, e := range v {
+				res[i] = walkLeaves(path.append(pathElem{Index: i, IsIndex: true}), e, f)
+			}
+			return res
+		}
+	}
+	return f(path, v)
+}
@@ -0,0 +1,150 @@
+package ursonnet
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+)
+
+func TestRedactor(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "main.jsonnet")
+	const content = `function(password) {
+  secret: {
+    stringData: {
+      password: password,
+      user: std.extVar('user'),
+    },
+  },
+  deployment: {
+    args: ['--password=' + password],
+    image: 'foo:' + std.extVar('tag'),
+  },
+  token: std.extVar('token'),
+}
+`
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := NewCache(func() *jsonnet.VM {
+		vm := jsonnet.MakeVM()
+		vm.TLAVar("password", "hunter2")
+		vm.ExtVar("user", "admin")
+		vm.ExtVar("tag", "1")
+		vm.ExtVar("token", "t0k3n")
+		return vm
+	})
+	r, err := NewRedactor(c, filename, []string{"password", "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secrets := []struct {
+		path   string
+		secret bool
+	}{
+		{"$.secret.stringData.password", true},
+		{`$.secret["stringData"].password`, true},
+		{`$["secret"]["stringData"]["password"]`, true},
+		{`$.secret.stringData["password"]`, true},
+		{"$.secret.stringData", true},
+		{"$", true},
+		{"$.secret.stringData.user", false},
+		{`$.secret["stringData"]["user"]`, false},
+		{"$.deployment.image", false},
+		{"$.deployment.args[0]", true},
+		{"$.deployment.args", true},
+		{"$.token", true},
+		{"$.removed", true},
+		{"$.secret.stringData.password + ''", true},
+		{"std.length($.deployment.image)", false},
+	}
+	for _, test := range secrets {
+		if got := r.Secret(test.path); got != test.secret {
+			t.Errorf("Secret(%q) = %v, want %v", test.path, got, test.secret)
+		}
+	}
+
+	values := []struct {
+		path, value, want string
+	}{
+		{`$.secret["stringData"]`, `{"password": "hunter2", "user": "admin"}`, `{"password":"<redacted>","user":"admin"}`},
+		{"$.secret.stringData.user", `"admin"`, `"admin"`},
+		{"$.deployment", `{"args": ["--password=hunter2"], "image": "foo:1"}`, `{"args":["<redacted>"],"image":"foo:1"}`},
+		{"$.token", `"t0k3n"`, `"<redacted>"`},
+		{"$.removed", `{"a": 1}`, `{"a":"<redacted>"}`},
+		{"$.secret.stringData", "", ""},
+		{"$.token + ''", `"t0k3n"`, `"<redacted>"`},
+	}
+	for _, test := range values {
+		if got := r.Value(test.path, test.value); got != test.want {
+			t.Errorf("Value(%q, %s) = %s, want %s", test.path, test.value, got, test.want)
+		}
+	}
+
+	output, err := c.Evaluate(filename, "$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	redacted := r.Output(output)
+	for _, s := range []string{"hunter2", "t0k3n"} {
+		if strings.Contains(redacted, s) {
+			t.Errorf("Output leaks %s: %s", s, redacted)
+		}
+	}
+	if !strings.Contains(redacted, `"image":"foo:1"`) {
+		t.Errorf("Output redacts the image: %s", redacted)
+	}
+}
+
+func TestNilRedactor(t *testing.T) {
+	r, err := NewRedactor(nil, "main.jsonnet", nil)
+	if err != nil || r != nil {
+		t.Fatalf("NewRedactor without secrets = %v, %v, want nil", r, err)
+	}
+	if r.Secret("$.a") {
+		t.Error("a nil Redactor found a secret")
+	}
+	if got := r.Value("$.a", `{"b": 1}`); got != `{"b": 1}` {
+		t.Errorf("a nil Redactor changed the value to %s", got)
+	}
+}
+
+func TestRedactorParameters(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "main.jsonnet")
+	const content = `function(user='admin', password='hunter2') {
+  secret: {
+    stringData: {
+      user: user,
+      password: password,
+    },
+  },
+}
+`
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, password := range []string{"", "topsecret"} {
+		c := NewCache(func() *jsonnet.VM {
+			vm := jsonnet.MakeVM()
+			if password != "" {
+				vm.TLAVar("password", password)
+			}
+			return vm
+		})
+		r, err := NewRedactor(c, filename, []string{"password"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		output, err := c.Evaluate(filename, "$")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `{"secret":{"stringData":{"password":"<redacted>","user":"admin"}}}`
+		if got := r.Output(output); got != want {
+			t.Errorf("password %q: Output = %s, want %s", password, got, want)
+		}
+	}
+}
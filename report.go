@@ -0,0 +1,130 @@
+package ursonnet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Report selects the fields of Kubernetes objects that ReportFields finds.
+type Report string
+
+const (
+	// ReportImages finds the images of the containers, init containers and ephemeral containers.
+	ReportImages Report = "images"
+	// ReportResources finds the resource requests and limits of the containers.
+	ReportResources Report = "resources"
+	// ReportReplicas finds the replica counts, spec.replicas.
+	ReportReplicas Report = "replicas"
+	// ReportNamespaces finds the namespaces of the objects.
+	ReportNamespaces Report = "namespaces"
+)
+
+// ReportField is a field of a Kubernetes object found by ReportFields.
+type ReportField struct {
+	// Object is the address of the object, like `apps/v1/Deployment/ns/foo`.
+	Object string
+	// Field is the field path relative to the object, like `.spec.replicas`.
+	Field string
+	// Path is the field path in the output, like `$.deployment.spec.replicas`.
+	Path string
+	// Value is the JSON value.
+	Value string
+}
+
+var containerLists = []string{"containers", "initContainers", "ephemeralContainers"}
+
+// ReportFields finds the fields selected by r across the Kubernetes objects of a JSON output.
+// Containers are found in any array of containers of the objects, whatever their kind.
+func ReportFields(output string, r Report) ([]ReportField, error) {
+	objs, err := Objects(output)
+	if err != nil {
+		return nil, err
+	}
+	var res []ReportField
+	for _, o := range objs {
+		add := func(rel fieldPath, v interface{}) {
+			field := strings.TrimPrefix(rel.String(), "$")
+			res = append(res, ReportField{Object: o.Address(), Field: field, Path: o.Path + field, Value: toJSON(v)})
+		}
+		switch r {
+		case ReportImages, ReportResources:
+			for _, c := range containers(nil, o.Value) {
+				if r == ReportImages {
+					if image, ok := c.value["image"]; ok {
+						add(c.path.append(pathElem{Field: "image"}), image)
+					}
+					continue
+				}
+				resources, _ := c.value["resources"].(map[string]interface{})
+				for _, section := range []string{"requests", "limits"} {
+					values, _ := resources[section].(map[string]interface{})
+					for _, name := range sortedFields(values) {
+						add(append(c.path.append(pathElem{Field: "resources"}), pathElem{Field: section}, pathElem{Field: name}), values[name])
+					}
+				}
+			}
+		case ReportReplicas:
+			if spec, ok := o.Value["spec"].(map[string]interface{}); ok {
+				if replicas, ok := spec["replicas"]; ok {
+					add(fieldPath{{Field: "spec"}, {Field: "replicas"}}, replicas)
+				}
+			}
+		case ReportNamespaces:
+			if o.Namespace != "" {
+				add(fieldPath{{Field: "metadata"}, {Field: "namespace"}}, o.Namespace)
+			}
+		default:
+			return nil, fmt.Errorf("unknown report %q", r)
+		}
+	}
+	return res, nil
+}
+
+type container struct {
+	path  fieldPath
+	value map[string]interface{}
+}
+
+// containers returns the elements of the arrays of containers nested in v, in field order.
+func containers(path fieldPath, v interface{}) []container {
+	var res []container
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedFields(v) {
+			p := path.append(pathElem{Field: k})
+			if list, ok := v[k].([]interface{}); ok && isContainerList(k) {
+				for i, e := range list {
+					if c, ok := e.(map[string]interface{}); ok {
+						res = append(res, container{path: p.append(pathElem{Index: i, IsIndex: true}), value: c})
+					}
+				}
+				continue
+			}
+			res = append(res, containers(p, v[k])...)
+		}
+	case []interface{}:
+		for i, e := range v {
+			res = append(res, containers(path.append(pathElem{Index: i, IsIndex: true}), e)...)
+		}
+	}
+	return res
+}
+
+func isContainerList(field string) bool {
+	for _, f := range containerLists {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedFields(m map[string]interface{}) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,57 @@
+package ursonnet
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReportFields(t *testing.T) {
+	const output = `{
+  "deploy": {
+    "apiVersion": "apps/v1",
+    "kind": "Deployment",
+    "metadata": {"name": "foo", "namespace": "ns"},
+    "spec": {
+      "replicas": 3,
+      "template": {"spec": {
+        "initContainers": [{"name": "init", "image": "busybox"}],
+        "containers": [{"name": "foo", "image": "foo:1", "resources": {"limits": {"memory": "1Gi", "cpu": "1"}}}]
+      }}
+    }
+  },
+  "ns": {"apiVersion": "v1", "kind": "Namespace", "metadata": {"name": "ns"}}
+}`
+	const deploy = "apps/v1/Deployment/ns/foo"
+	tests := []struct {
+		report Report
+		want   []ReportField
+	}{
+		{ReportImages, []ReportField{
+			{deploy, ".spec.template.spec.containers[0].image", "$.deploy.spec.template.spec.containers[0].image", `"foo:1"`},
+			{deploy, ".spec.template.spec.initContainers[0].image", "$.deploy.spec.template.spec.initContainers[0].image", `"busybox"`},
+		}},
+		{ReportResources, []ReportField{
+			{deploy, ".spec.template.spec.containers[0].resources.limits.cpu", "$.deploy.spec.template.spec.containers[0].resources.limits.cpu", `"1"`},
+			{deploy, ".spec.template.spec.containers[0].resources.limits.memory", "$.deploy.spec.template.spec.containers[0].resources.limits.memory", `"1Gi"`},
+		}},
+		{ReportReplicas, []ReportField{
+			{deploy, ".spec.replicas", "$.deploy.spec.replicas", "3"},
+		}},
+		{ReportNamespaces, []ReportField{
+			{deploy, ".metadata.namespace", "$.deploy.metadata.namespace", `"ns"`},
+		}},
+	}
+	for _, test := range tests {
+		got, err := ReportFields(output, test.report)
+		if err != nil {
+			t.Errorf("%s: %v", test.report, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.report, got, test.want)
+		}
+	}
+	if _, err := ReportFields(output, "ports"); err == nil {
+		t.Error("an unknown report succeeded")
+	}
+}
@@ -0,0 +1,257 @@
+package ursonnet
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/kubecfg/ursonnet/internal/unparser"
+)
+
+// Layer selects where Set edits the value of a field.
+type Layer string
+
+const (
+	// LayerBase edits the literal root wherever it is defined, typically in a base library.
+	LayerBase Layer = "base"
+	// LayerOverride edits the entrypoint file, adding an override to its top-level object if it
+	// doesn't already define the literal root.
+	LayerOverride Layer = "override"
+)
+
+// SetOpt is an option for Set
+type SetOpt func(opts *setOptions)
+
+type setOptions struct {
+	layer       Layer
+	options     unparser.Options
+	libraryDirs []string
+}
+
+// AtLayer sets which layer Set edits. The default is LayerBase.
+func AtLayer(l Layer) SetOpt {
+	return func(opts *setOptions) {
+		opts.layer = l
+	}
+}
+
+// SetLibraryDirs sets the library directories whose literals Set only edits if there is no alternative,
+// like LibraryDirs does for Suggest.
+func SetLibraryDirs(dirs ...string) SetOpt {
+	return func(opts *setOptions) {
+		opts.libraryDirs = append(opts.libraryDirs, dirs...)
+	}
+}
+
+// FormatOptions sets the formatting options used to render the new value.
+func FormatOptions(o unparser.Options) SetOpt {
+	return func(opts *setOptions) {
+		opts.options = o
+	}
+}
+
+// FileEdit is the new content of a jsonnet source file.
+type FileEdit struct {
+	Filename string
+	// Line is where the edited value starts in the new content.
+	Line    int
+	Content string
+}
+
+// Set finds the literal root that produces the value of expr (a `$`-rooted field path) in the
+// jsonnet file identified by filename, and returns the content of the file it lives in with the
+// literal replaced by value, a jsonnet expression. Everything else in the file, comments and
+// formatting included, is preserved.
+//
+// The file is not written; that is left to the caller.
+func Set(vm *jsonnet.VM, filename string, expr string, value string, opts ...SetOpt) (*FileEdit, error) {
+	opt := setOptions{layer: LayerBase, options: unparser.DefaultOptions()}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	path, err := parseFieldPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
+		return nil, fmt.Errorf("cannot set the whole output")
+	}
+	text, err := renderValue(value, opt.options)
+	if err != nil {
+		return nil, err
+	}
+
+	roots, err := Roots(vm, filename, expr)
+	if err != nil {
+		if opt.layer != LayerOverride {
+			return nil, err
+		}
+		// The field may not exist yet, in which case the override adds it.
+		roots = nil
+	}
+	src, field, err := findLiteralRoot(vm, filename, expr, roots, opt.libraryDirs)
+	if err != nil {
+		return nil, err
+	}
+
+	switch opt.layer {
+	case LayerBase:
+	case LayerOverride:
+		entry, err := loadSource(vm, "", filename)
+		if err != nil {
+			return nil, err
+		}
+		if src == nil || src.filename != entry.filename {
+			return addOverride(entry, path, text, opt.options)
+		}
+	default:
+		return nil, fmt.Errorf("unknown layer %q", opt.layer)
+	}
+
+	if src == nil {
+		return nil, fmt.Errorf("no literal root found for %s; try --layer=%s", expr, LayerOverride)
+	}
+	if src.data {
+		if text, err = dataValue(value); err != nil {
+			return nil, fmt.Errorf("%s: %w", src.filename, err)
+		}
+	}
+	return &FileEdit{
+		Filename: src.filename,
+		Line:     field.Body.Loc().Begin.Line,
+		Content:  src.splice(*field.Body.Loc(), text),
+	}, nil
+}
+
+// findLiteralRoot returns the field holding the literal root of expr, along with its source file:
+// the root Suggest would pick, following the reference hops, if it is a literal field.
+// It returns a nil source if there is none.
+func findLiteralRoot(vm *jsonnet.VM, filename, expr string, roots []string, libraryDirs []string) (*source, *ast.DesugaredObjectField, error) {
+	cands, _, _, err := rankRoots(vm, filename, expr, roots, libraryDirs)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(cands) == 0 || !cands[0].literal || cands[0].field == nil {
+		return nil, nil, nil
+	}
+	return cands[0].src, cands[0].field, nil
+}
+
+// renderValue checks that value is a valid jsonnet expression and renders it.
+// Plain data (literals, arrays and objects thereof) is reformatted according to options,
+// anything else is kept as written.
+func renderValue(value string, options unparser.Options) (string, error) {
+	a, err := jsonnet.SnippetToAST("<value>", value)
+	if err != nil {
+		return "", err
+	}
+	if !isData(a) {
+		return strings.TrimSpace(value), nil
+	}
+	u := unparser.New(options)
+	u.Unparse(a, false)
+	return strings.TrimSpace(u.String()), nil
+}
+
+// dataValue returns the JSON value of value, evaluated on its own, to write it in a YAML or JSON data file.
+func dataValue(value string) (string, error) {
+	out, err := jsonnet.MakeVM().EvaluateAnonymousSnippet("<value>", value)
+	if err != nil {
+		return "", fmt.Errorf("only values evaluated on their own can be written to data files: %w", err)
+	}
+	v, err := decodeJSON(out)
+	if err != nil {
+		return "", err
+	}
+	return toJSON(v), nil
+}
+
+func isData(a ast.Node) bool {
+	switch a := a.(type) {
+	case *ast.Array:
+		for _, e := range a.Elements {
+			if !isData(e.Expr) {
+				return false
+			}
+		}
+		return true
+	case *ast.DesugaredObject:
+		for _, f := range a.Fields {
+			if _, ok := f.Name.(*ast.LiteralString); !ok || f.PlusSuper || !isData(f.Body) {
+				return false
+			}
+		}
+		return len(a.Asserts) == 0
+	}
+	return isLiteral(a)
+}
+
+// addOverride appends `+ { a+: { b+: { c: value } } }` to the top-level expression of the entrypoint.
+func addOverride(entry *source, path fieldPath, value string, options unparser.Options) (*FileEdit, error) {
+	body := entry.node
+	for {
+		l, ok := body.(*ast.Local)
+		if !ok {
+			break
+		}
+		body = l.Body
+	}
+	if _, ok := body.(*ast.Function); ok {
+		return nil, fmt.Errorf("cannot override fields of a top-level function in %s", entry.filename)
+	}
+
+	indent := strings.Repeat(" ", options.Indent)
+	var b strings.Builder
+	b.WriteString(" + {\n")
+	for i, e := range path {
+		if e.IsIndex {
+			return nil, fmt.Errorf("cannot override array element %s; try --layer=%s", path[:i+1], LayerBase)
+		}
+		name := e.Field
+		if !options.PrettyFieldNames || !unparser.IsValidIdentifier(name) {
+			name = unparser.Quote(name, options.StringStyle)
+		}
+		b.WriteString(strings.Repeat(indent, i+1))
+		b.WriteString(name)
+		if i < len(path)-1 {
+			b.WriteString("+: {\n")
+		} else {
+			b.WriteString(": ")
+			b.WriteString(strings.ReplaceAll(value, "\n", "\n"+strings.Repeat(indent, i+1)))
+			b.WriteString(",\n")
+		}
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		b.WriteString(strings.Repeat(indent, i))
+		if i > 0 {
+			b.WriteString("},\n")
+		} else {
+			b.WriteString("}")
+		}
+	}
+
+	r := *body.Loc()
+	begin, end := entry.offset(r.Begin), entry.offset(r.End)
+	expr := entry.content[begin:end]
+	if !appendable(body) {
+		expr = "(" + expr + ")"
+	}
+	return &FileEdit{
+		Filename: entry.filename,
+		Line:     r.End.Line + len(path),
+		Content:  entry.content[:begin] + expr + b.String() + entry.content[end:],
+	}, nil
+}
+
+// appendable reports whether `+ {...}` can be appended to a without parentheses.
+func appendable(a ast.Node) bool {
+	switch a := a.(type) {
+	case *ast.Binary:
+		return a.Op == ast.BopPlus
+	case *ast.DesugaredObject, *ast.Var, *ast.Index, *ast.Apply, *ast.Self, *ast.Parens:
+		return true
+	}
+	return false
+}
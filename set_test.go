@@ -0,0 +1,194 @@
+package ursonnet
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+)
+
+// copyTestdata copies the testdata directory into a temporary directory, so that tests can write to it.
+func copyTestdata(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	entries, err := os.ReadDir("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		b, err := os.ReadFile(filepath.Join("testdata", e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, e.Name()), b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		name  string
+		path  string
+		value string
+		opts  []SetOpt
+		// file and line are where the value is written, want the resulting value of path.
+		file string
+		line int
+		want string
+	}{
+		{
+			name:  "literal in a base library",
+			path:  "$.deployment.spec.template.spec.containers[0].resources.limits.memory",
+			value: `"3Gi"`,
+			file:  "config.libsonnet",
+			line:  4,
+			want:  `"3Gi"`,
+		},
+		{
+			name:  "through references with other names",
+			path:  "$.deployment.spec.template.metadata.labels.app",
+			value: `"other"`,
+			file:  "config.libsonnet",
+			line:  2,
+			want:  `"other"`,
+		},
+		{
+			name:  "literal in the same file",
+			path:  "$.deployment.metadata.name",
+			value: `'bar'`,
+			file:  "common.libsonnet",
+			line:  10,
+			want:  `"bar"`,
+		},
+		{
+			name:  "override in the entrypoint",
+			path:  "$.deployment.metadata.name",
+			value: `"bar"`,
+			opts:  []SetOpt{AtLayer(LayerOverride)},
+			file:  "child.jsonnet",
+			line:  4,
+			want:  `"bar"`,
+		},
+		{
+			name:  "new field in the entrypoint",
+			path:  "$.deployment.metadata.namespace",
+			value: `"prod"`,
+			opts:  []SetOpt{AtLayer(LayerOverride)},
+			file:  "child.jsonnet",
+			line:  4,
+			want:  `"prod"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := copyTestdata(t)
+			entrypoint := filepath.Join(dir, "child.jsonnet")
+			edit, err := Set(jsonnet.MakeVM(), entrypoint, test.path, test.value, test.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(dir, test.file); edit.Filename != want {
+				t.Errorf("edited %s, want %s", edit.Filename, want)
+			}
+			if edit.Line != test.line {
+				t.Errorf("edited line %d, want %d", edit.Line, test.line)
+			}
+			before, err := os.ReadFile(edit.Filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.opts == nil {
+				// only the literal changes
+				b, a := strings.Split(string(before), "\n"), strings.Split(edit.Content, "\n")
+				if len(a) != len(b) {
+					t.Fatalf("edit changed the number of lines:\n%s", edit.Content)
+				}
+				for i := range a {
+					if (a[i] != b[i]) != (i == test.line-1) {
+						t.Errorf("line %d: %q -> %q", i+1, b[i], a[i])
+					}
+				}
+			}
+			if err := os.WriteFile(edit.Filename, []byte(edit.Content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Evaluate(jsonnet.MakeVM(), entrypoint, test.path)
+			if err != nil {
+				t.Fatalf("evaluating the edited files: %v\n%s", err, edit.Content)
+			}
+			if strings.TrimSpace(got) != test.want {
+				t.Errorf("%s = %s after the edit, want %s", test.path, strings.TrimSpace(got), test.want)
+			}
+		})
+	}
+}
+
+func TestSetErrors(t *testing.T) {
+	tests := []struct {
+		path  string
+		value string
+	}{
+		{"$", `"x"`},
+		{"$.deployment.metadata.name", `"unterminated`},
+		{"$.deployment.metadata.namespace", `"prod"`},
+		{"$.deployment.spec.template.spec.containers", `[]`},
+	}
+	for _, test := range tests {
+		if _, err := Set(jsonnet.MakeVM(), "testdata/child.jsonnet", test.path, test.value); err == nil {
+			t.Errorf("Set(%s, %s) succeeded, want an error", test.path, test.value)
+		}
+	}
+}
+
+func TestSetData(t *testing.T) {
+	tests := []struct {
+		path  string
+		value string
+		// line is the line of values.yaml written, want the resulting value of path.
+		line    int
+		written string
+		want    string
+	}{
+		{"$.image", `'a\\b'`, 2, `image: "a\\b"`, `"a\\b"`},
+		{"$.image", `"foo:" + "2"`, 2, `image: "foo:2"`, `"foo:2"`},
+		{"$.image", `std.join(':', ['foo', '3'])`, 2, `image: "foo:3"`, `"foo:3"`},
+		{"$.replicas", `5`, 3, `replicas: 5`, `5`},
+		{"$.labels.app", `{name: 'foo', tiers: ['web', "db"]}`, 4, `labels: {app: {"name":"foo","tiers":["web","db"]}}`, `{"name":"foo","tiers":["web","db"]}`},
+	}
+	for _, test := range tests {
+		dir := copyTestdata(t)
+		entrypoint := filepath.Join(dir, "data.jsonnet")
+		edit, err := Set(jsonnet.MakeVM(), entrypoint, test.path, test.value)
+		if err != nil {
+			t.Errorf("Set(%s, %s): %v", test.path, test.value, err)
+			continue
+		}
+		if want := filepath.Join(dir, "values.yaml"); edit.Filename != want || edit.Line != test.line {
+			t.Errorf("Set(%s, %s) edited %s:%d, want %s:%d", test.path, test.value, edit.Filename, edit.Line, want, test.line)
+		}
+		if got := strings.Split(edit.Content, "\n")[test.line-1]; got != test.written {
+			t.Errorf("Set(%s, %s) wrote %q, want %q", test.path, test.value, got, test.written)
+		}
+		if err := os.WriteFile(edit.Filename, []byte(edit.Content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Evaluate(jsonnet.MakeVM(), entrypoint, test.path)
+		if err != nil {
+			t.Errorf("evaluating the edited files: %v\n%s", err, edit.Content)
+			continue
+		}
+		if got := strings.Join(strings.Fields(got), ""); got != test.want {
+			t.Errorf("%s = %s after the edit, want %s", test.path, got, test.want)
+		}
+	}
+
+	for _, value := range []string{`self.replicas`, `std.extVar('image')`, `function(x) x`, `error 'no'`} {
+		if _, err := Set(jsonnet.MakeVM(), "testdata/data.jsonnet", "$.image", value); err == nil {
+			t.Errorf("Set of %s in a data file succeeded", value)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package ursonnet
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/google/go-jsonnet/formatter"
+	"github.com/google/go-jsonnet/toolutils"
+	"github.com/kubecfg/ursonnet/internal/unparser"
+	"github.com/kubecfg/ursonnet/transformast"
+)
+
+const prunedMessage = "pruned by ursonnet"
+
+// Slice returns a standalone jsonnet program that evaluates to the same value as expr in the context
+// of the jsonnet file identified by filename, but contains only the definitions on the causal path:
+// imports are inlined (each imported file becomes a top-level local), fields that were not evaluated
+// are removed and so are the locals that end up unused.
+//
+// Removing fields can change the result when they are only enumerated (e.g. by std.objectFields)
+// rather than evaluated; in that case the fields are kept, with their body replaced by an error.
+// Either way the result is checked by evaluating it.
+//
+// Entrypoints whose top level is a function are not supported: slice a file that calls the function instead.
+func Slice(vm *jsonnet.VM, filename string, expr string) (string, error) {
+	want, err := evaluatePatched(vm, filename, expr, nil)
+	if err != nil {
+		return "", err
+	}
+	roots, err := Roots(vm, filename, expr)
+	if err != nil {
+		return "", err
+	}
+	live := map[string]bool{}
+	for _, r := range roots {
+		live[strings.TrimSpace(r)] = true
+	}
+
+	// evaluated away from the original files, so that imports left behind would fail
+	neutral := filepath.Join(os.TempDir(), "ursonnet-slice", filepath.Base(filename))
+	for _, remove := range []bool{true, false} {
+		res, err := slice(vm, filename, expr, live, remove)
+		if err != nil {
+			return "", err
+		}
+		if imported := importsOf(res); len(imported) > 0 {
+			return "", fmt.Errorf("cannot slice %s: the sliced program still imports %s", filename, strings.Join(imported, ", "))
+		}
+		got, err := vm.EvaluateAnonymousSnippet(neutral, res)
+		if err == nil && got == want {
+			return res, nil
+		}
+	}
+	return "", fmt.Errorf("cannot slice %s: the sliced program doesn't evaluate to the same value", filename)
+}
+
+func slice(vm *jsonnet.VM, filename string, expr string, live map[string]bool, remove bool) (string, error) {
+	root, err := queryAST(filename, expr)
+	if err != nil {
+		return "", err
+	}
+	files := map[string]ast.Node{}
+	if root, err = expandImports(vm, root, files, nil); err != nil {
+		return "", err
+	}
+	if lifted, err := liftFunction(vm, root, filename, files, false); err != nil {
+		return "", err
+	} else if lifted != root {
+		return "", fmt.Errorf("cannot slice %s: entrypoints whose top level is a function are not supported, slice a file calling it instead", filename)
+	}
+	if root, err = transformast.Transform(root, inlineImportData(vm)); err != nil {
+		return "", err
+	}
+
+	// each file gets a top-level local; files whose AST is the one of another file
+	// (because they consist only of an import) share its local.
+	var foundAts []string
+	for f := range files {
+		foundAts = append(foundAts, f)
+	}
+	sort.Strings(foundAts)
+	names := map[ast.Node]ast.Identifier{}
+	taken := map[ast.Identifier]bool{}
+	for _, f := range foundAts {
+		if _, ok := names[files[f]]; !ok {
+			names[files[f]] = localName(f, taken)
+		}
+	}
+
+	hoist := func(a ast.Node) (ast.Node, error) {
+		return transformast.Transform(a, func(node ast.Node) (ast.Node, error) {
+			if name, ok := names[node]; ok && node != a {
+				return &ast.Var{Id: name}, nil
+			}
+			return node, nil
+		})
+	}
+	var binds ast.LocalBinds
+	for _, f := range foundAts {
+		a := files[f]
+		name := names[a]
+		if taken[name] {
+			delete(taken, name) // bind only once
+			if _, err := hoist(a); err != nil {
+				return "", err
+			}
+			if a, err = transformast.Transform(a, pruneFields(live, remove)); err != nil {
+				return "", err
+			}
+			binds = append(binds, ast.LocalBind{Variable: name, Body: a})
+		}
+	}
+
+	var body ast.Node
+	if path, err := parseFieldPath(expr); err == nil {
+		_, foundAt, err := vm.ImportData(ursonnetTraceTag, filename)
+		if err != nil {
+			return "", err
+		}
+		body = &ast.Var{Id: names[files[foundAt]]}
+		for _, e := range path {
+			if e.IsIndex {
+				body = &ast.Index{Target: body, Index: &ast.LiteralNumber{OriginalString: strconv.Itoa(e.Index)}}
+			} else {
+				body = &ast.Index{Target: body, Index: &ast.LiteralString{Value: e.Field}}
+			}
+		}
+	} else {
+		if root, err = hoist(root); err != nil {
+			return "", err
+		}
+		// `local $ = ...` can't be printed: refer to the local of the entrypoint instead
+		q := root.(*ast.Local)
+		top := q.Binds[0].Body
+		if body, err = transformast.Transform(q.Body, func(node ast.Node) (ast.Node, error) {
+			if v, ok := node.(*ast.Var); ok && v.Id == "$" {
+				return top, nil
+			}
+			return node, nil
+		}); err != nil {
+			return "", err
+		}
+	}
+
+	var prog ast.Node = &ast.Local{Binds: binds, Body: body}
+	removeUnusedLocals(prog)
+	prog = splitLocals(prog.(*ast.Local))
+
+	u := unparser.New(unparser.DefaultOptions())
+	u.Unparse(prog, false)
+	return formatter.Format(filename, u.String(), formatter.DefaultOptions())
+}
+
+// inlineImportData replaces importstr and importbin expressions with the contents of the imported file,
+// as a string or an array of bytes.
+func inlineImportData(vm *jsonnet.VM) transformast.NodeTransformer {
+	return func(node ast.Node) (ast.Node, error) {
+		switch node := node.(type) {
+		case *ast.ImportStr:
+			content, _, err := vm.ImportData(node.Loc().FileName, node.File.Value)
+			if err != nil {
+				return nil, err
+			}
+			return &ast.LiteralString{Value: content, Kind: ast.StringDouble}, nil
+		case *ast.ImportBin:
+			content, _, err := vm.ImportData(node.Loc().FileName, node.File.Value)
+			if err != nil {
+				return nil, err
+			}
+			bytes := &ast.Array{}
+			for _, b := range []byte(content) {
+				bytes.Elements = append(bytes.Elements, ast.CommaSeparatedExpr{
+					Expr: &ast.LiteralNumber{OriginalString: strconv.Itoa(int(b))},
+				})
+			}
+			return bytes, nil
+		}
+		return node, nil
+	}
+}
+
+// importsOf returns the paths imported by a jsonnet program, whatever the kind of import.
+func importsOf(program string) []string {
+	node, err := jsonnet.SnippetToAST("<slice>", program)
+	if err != nil {
+		return nil // reported by the evaluation
+	}
+	var res []string
+	var walk func(a ast.Node)
+	walk = func(a ast.Node) {
+		switch a := a.(type) {
+		case *ast.Import:
+			res = append(res, a.File.Value)
+		case *ast.ImportStr:
+			res = append(res, a.File.Value)
+		case *ast.ImportBin:
+			res = append(res, a.File.Value)
+		}
+		for _, c := range toolutils.Children(a) {
+			walk(c)
+		}
+	}
+	walk(node)
+	return res
+}
+
+// pruneFields removes (or, if remove is false, replaces with an error) the non-object fields
+// that were not evaluated, i.e. whose location is not in live. If remove is true, fields that
+// are left with an empty object as a result are removed too.
+func pruneFields(live map[string]bool, remove bool) transformast.NodeTransformer {
+	return func(node ast.Node) (ast.Node, error) {
+		o, ok := node.(*ast.DesugaredObject)
+		if !ok {
+			return node, nil
+		}
+		var fields ast.DesugaredObjectFields
+		for _, f := range o.Fields {
+			if f.LocRange.FileName == ursonnetTraceTag || live[fmt.Sprintf("%s:%d", f.LocRange.FileName, f.LocRange.Begin.Line)] {
+				fields = append(fields, f)
+				continue
+			}
+			if body, isObj := f.Body.(*ast.DesugaredObject); isObj {
+				if !remove || len(body.Fields) > 0 {
+					fields = append(fields, f)
+				}
+				continue
+			}
+			if !remove {
+				f.Body = &ast.Error{Expr: &ast.LiteralString{Value: prunedMessage}}
+				fields = append(fields, f)
+			}
+		}
+		o.Fields = fields
+		return o, nil
+	}
+}
+
+// removeUnusedLocals removes the local bindings (including object locals) that are not referenced.
+// Shadowing is not taken into account, so some unused locals may be kept.
+func removeUnusedLocals(a ast.Node) {
+	for _, c := range toolutils.Children(a) {
+		removeUnusedLocals(c)
+	}
+	switch a := a.(type) {
+	case *ast.Local:
+		a.Binds = usedBinds(a.Binds, a.Body)
+		if len(a.Binds) == 0 {
+			// an empty local cannot be printed; evaluate the body in its place
+			a.Binds = ast.LocalBinds{{Variable: "_", Body: &ast.LiteralNull{}}}
+		}
+	case *ast.DesugaredObject:
+		uses := append(ast.Nodes{}, a.Asserts...)
+		for _, f := range a.Fields {
+			uses = append(uses, f.Name, f.Body)
+		}
+		a.Locals = usedBinds(a.Locals, uses...)
+	}
+}
+
+// usedBinds returns the binds referenced by the uses or, transitively, by other used binds.
+func usedBinds(binds ast.LocalBinds, uses ...ast.Node) ast.LocalBinds {
+	used := map[ast.Identifier]bool{}
+	for _, u := range uses {
+		freeVars(u, used)
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, b := range binds {
+			if used[b.Variable] {
+				n := len(used)
+				freeVars(b.Body, used)
+				changed = changed || len(used) != n
+			}
+		}
+	}
+	var res ast.LocalBinds
+	for _, b := range binds {
+		if used[b.Variable] || b.Variable == "$" {
+			res = append(res, b)
+		}
+	}
+	return res
+}
+
+// freeVars collects all the variables referenced in a.
+func freeVars(a ast.Node, res map[ast.Identifier]bool) {
+	if v, ok := a.(*ast.Var); ok {
+		res[v.Id] = true
+	}
+	for _, c := range toolutils.Children(a) {
+		freeVars(c, res)
+	}
+}
+
+// splitLocals rewrites the top-level local into one local per file, each after the files it uses,
+// so that the program reads top down. Import cycles are kept as a single local.
+func splitLocals(l *ast.Local) ast.Node {
+	deps := map[ast.Identifier]map[ast.Identifier]bool{}
+	for _, b := range l.Binds {
+		deps[b.Variable] = map[ast.Identifier]bool{}
+		freeVars(b.Body, deps[b.Variable])
+	}
+	var sorted ast.LocalBinds
+	state := map[ast.Identifier]int{} // 1: visiting, 2: done
+	var visit func(b ast.LocalBind) bool
+	visit = func(b ast.LocalBind) bool {
+		switch state[b.Variable] {
+		case 1:
+			return false
+		case 2:
+			return true
+		}
+		state[b.Variable] = 1
+		for _, d := range l.Binds {
+			if deps[b.Variable][d.Variable] && d.Variable != b.Variable && !visit(d) {
+				return false
+			}
+		}
+		state[b.Variable] = 2
+		switch b.Body.(type) {
+		case *ast.Local, *ast.Binary:
+			// start multi-line expressions on their own line
+			*leftmost(b.Body).OpenFodder() = ast.Fodder{{Kind: ast.FodderLineEnd, Indent: 2}}
+		}
+		sorted = append(sorted, b)
+		return true
+	}
+	for _, b := range l.Binds {
+		if !visit(b) {
+			return l
+		}
+	}
+	var res ast.Node = l.Body
+	for i := len(sorted) - 1; i >= 0; i-- {
+		separate(res)
+		res = &ast.Local{Binds: ast.LocalBinds{sorted[i]}, Body: res}
+	}
+	return res
+}
+
+// separate makes the unparser put a blank line before a.
+func separate(a ast.Node) {
+	*leftmost(a).OpenFodder() = ast.Fodder{{Kind: ast.FodderLineEnd, Blanks: 1}}
+}
+
+// leftmost returns the node whose fodder is printed first when a is unparsed.
+func leftmost(a ast.Node) ast.Node {
+	for {
+		switch n := a.(type) {
+		case *ast.Apply:
+			a = n.Target
+		case *ast.ApplyBrace:
+			a = n.Left
+		case *ast.Binary:
+			a = n.Left
+		case *ast.Index:
+			a = n.Target
+		case *ast.Slice:
+			a = n.Target
+		default:
+			return a
+		}
+	}
+}
+
+// localName turns a file name into a unique jsonnet identifier.
+func localName(filename string, taken map[ast.Identifier]bool) ast.Identifier {
+	base := strings.Map(func(r rune) rune {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, filepath.Base(filename))
+	name := ast.Identifier("import_" + base)
+	for i := 2; taken[name]; i++ {
+		name = ast.Identifier(fmt.Sprintf("import_%s_%d", base, i))
+	}
+	taken[name] = true
+	return name
+}
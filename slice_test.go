@@ -0,0 +1,91 @@
+package ursonnet
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+)
+
+func TestSlice(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.jsonnet": `local values = std.parseYaml(importstr 'values.yaml');
+local lib = import 'lib.libsonnet';
+{
+  replicas: values.replicas,
+  unused: lib.unused,
+  banner: importstr 'banner.txt',
+  size: std.length(importbin 'banner.txt'),
+  name: lib.name,
+}
+`,
+		"lib.libsonnet": `{
+  name: 'app',
+  unused: error 'not evaluated',
+}
+`,
+		"values.yaml": "replicas: 3\n",
+		"banner.txt":  "hi\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entrypoint := filepath.Join(dir, "main.jsonnet")
+
+	for _, expr := range []string{"$.replicas", "$.banner", "$.size", "$.name", "[$.name, $.size]"} {
+		vm := jsonnet.MakeVM()
+		want, err := Evaluate(vm, entrypoint, expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := Slice(vm, entrypoint, expr)
+		if err != nil {
+			t.Errorf("Slice(%s): %v", expr, err)
+			continue
+		}
+		if imported := importsOf(res); len(imported) > 0 {
+			t.Errorf("Slice(%s) imports %q:\n%s", expr, imported, res)
+		}
+		got, err := jsonnet.MakeVM().EvaluateAnonymousSnippet("slice.jsonnet", res)
+		if err != nil {
+			t.Errorf("evaluating the slice of %s: %v\n%s", expr, err, res)
+			continue
+		}
+		if got != want {
+			t.Errorf("the slice of %s evaluates to %s, want %s", expr, got, want)
+		}
+	}
+}
+
+func TestSliceFunction(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"env.jsonnet":  "function(env, replicas=1) {\n  name: 'foo-' + env,\n  replicas: replicas,\n}\n",
+		"prod.jsonnet": "(import 'env.jsonnet')(env='prod')\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	vm := jsonnet.MakeVM()
+	vm.TLAVar("env", "prod")
+	if _, err := Slice(vm, filepath.Join(dir, "env.jsonnet"), "$.name"); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("slicing a function entrypoint: got error %v, want not supported", err)
+	}
+
+	res, err := Slice(jsonnet.MakeVM(), filepath.Join(dir, "prod.jsonnet"), "$.name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := jsonnet.MakeVM().EvaluateAnonymousSnippet("slice.jsonnet", res)
+	if err != nil || got != "\"foo-prod\"\n" {
+		t.Errorf("the slice of a file calling the function evaluates to %q, %v, want \"foo-prod\"\n%s", got, err, res)
+	}
+}
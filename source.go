@@ -0,0 +1,198 @@
+package ursonnet
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/google/go-jsonnet/toolutils"
+)
+
+// source is a jsonnet file, or a data file, parsed afresh from its contents.
+// Unlike the ASTs returned by vm.ImportAST it is not shared with the VM import cache,
+// which expandImports and injectTrace modify in place.
+type source struct {
+	filename string
+	content  string
+	node     ast.Node
+	// data is set for data files, whose values are written in YAML or JSON rather than jsonnet.
+	data bool
+}
+
+// loadSource imports a file like `import` would from the file importedFrom.
+func loadSource(vm *jsonnet.VM, importedFrom, importedPath string) (*source, error) {
+	content, foundAt, err := vm.ImportData(importedFrom, importedPath)
+	if err != nil {
+		return nil, err
+	}
+	return parseSource(foundAt, content)
+}
+
+// parseSource parses the content of a file, which is either jsonnet or, since roots can be in data files
+// parsed with std.parseYaml or std.parseJson (see dataImport), YAML.
+func parseSource(filename, content string) (*source, error) {
+	node, err := jsonnet.SnippetToAST(filename, content)
+	if err == nil {
+		return &source{filename: filename, content: content, node: node}, nil
+	}
+	data, ok := parseData("parseYaml", filename, content)
+	if !ok {
+		return nil, err
+	}
+	unliteral(data)
+	return &source{filename: filename, content: content, node: data, data: true}, nil
+}
+
+// unliteral wraps the field values of a data file that are literals without a text range, like multi-line strings,
+// in parentheses: they can't be spliced, so they must not be taken for literals.
+func unliteral(a ast.Node) {
+	if o, ok := a.(*ast.DesugaredObject); ok {
+		for i, f := range o.Fields {
+			if r := f.Body.Loc(); isLiteral(f.Body) && r.Begin == r.End {
+				o.Fields[i].Body = &ast.Parens{NodeBase: ast.NodeBase{LocRange: *r}, Inner: f.Body}
+			}
+		}
+	}
+	for _, c := range toolutils.Children(a) {
+		unliteral(c)
+	}
+}
+
+// fieldsAt returns the object fields whose definition starts at the given line.
+// These are the fields a "file:line" root produced by Roots refers to.
+func (s *source) fieldsAt(line int) []*ast.DesugaredObjectField {
+	var res []*ast.DesugaredObjectField
+	var walk func(a ast.Node)
+	walk = func(a ast.Node) {
+		if o, ok := a.(*ast.DesugaredObject); ok {
+			for i := range o.Fields {
+				if o.Fields[i].LocRange.Begin.Line == line {
+					res = append(res, &o.Fields[i])
+				}
+			}
+		}
+		for _, c := range toolutils.Children(a) {
+			walk(c)
+		}
+	}
+	walk(s.node)
+	return res
+}
+
+// parameterAt returns the parameter defined at the given line and column when the file is a function,
+// e.g. an entrypoint taking top-level arguments.
+func (s *source) parameterAt(line, column int) *ast.Parameter {
+	a := s.node
+	for {
+		l, ok := a.(*ast.Local)
+		if !ok {
+			break
+		}
+		a = l.Body
+	}
+	if fn, ok := a.(*ast.Function); ok {
+		for i, p := range fn.Parameters {
+			if p.LocRange.Begin.Line == line && p.LocRange.Begin.Column == column {
+				return &fn.Parameters[i]
+			}
+		}
+	}
+	return nil
+}
+
+// imports returns the paths imported by the file, as written.
+func (s *source) imports() []string {
+	var res []string
+	var walk func(a ast.Node)
+	walk = func(a ast.Node) {
+		if i, ok := a.(*ast.Import); ok {
+			res = append(res, i.File.Value)
+		}
+		for _, c := range toolutils.Children(a) {
+			walk(c)
+		}
+	}
+	walk(s.node)
+	return res
+}
+
+// offset converts a location into a byte offset in the file content.
+// Columns count runes, as they do in the jsonnet lexer.
+func (s *source) offset(loc ast.Location) int {
+	off := 0
+	for line := 1; line < loc.Line; line++ {
+		n := strings.IndexByte(s.content[off:], '\n')
+		if n < 0 {
+			return len(s.content)
+		}
+		off += n + 1
+	}
+	for col := 1; col < loc.Column && off < len(s.content); col++ {
+		_, w := utf8.DecodeRuneInString(s.content[off:])
+		off += w
+	}
+	return off
+}
+
+// splice returns the file content with the given range replaced by text.
+func (s *source) splice(r ast.LocationRange, text string) string {
+	return s.content[:s.offset(r.Begin)] + text + s.content[s.offset(r.End):]
+}
+
+// ParseRoot splits a "file:line" root as returned by Roots, or a "file:line" location.
+// The column of the roots of top-level arguments, "file:line:column", is dropped.
+func ParseRoot(root string) (file string, line int, err error) {
+	file, line, _, err = parseRootColumn(root)
+	return file, line, err
+}
+
+// parseRootColumn is like ParseRoot, returning the column of "file:line:column" roots, or else 0.
+func parseRootColumn(root string) (file string, line, column int, err error) {
+	root = strings.TrimSpace(root)
+	i := strings.LastIndexByte(root, ':')
+	if i < 0 {
+		return "", 0, 0, fmt.Errorf("malformed root %q", root)
+	}
+	line, err = strconv.Atoi(root[i+1:])
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("malformed root %q: %w", root, err)
+	}
+	if j := strings.LastIndexByte(root[:i], ':'); j >= 0 {
+		if l, err := strconv.Atoi(root[j+1 : i]); err == nil {
+			return root[:j], l, line, nil
+		}
+	}
+	return root[:i], line, 0, nil
+}
+
+// isLiteral reports whether a is a scalar literal, counting negative numbers.
+func isLiteral(a ast.Node) bool {
+	switch a := a.(type) {
+	case *ast.LiteralBoolean, *ast.LiteralNull, *ast.LiteralNumber, *ast.LiteralString:
+		return true
+	case *ast.Unary:
+		_, isNum := a.Expr.(*ast.LiteralNumber)
+		return a.Op == ast.UopMinus && isNum
+	}
+	return false
+}
+
+// matchesFile reports whether file refers to the file found at foundAt.
+// Both are resolved to absolute paths, relative paths being relative to the working directory like roots are.
+func matchesFile(foundAt, file string) bool {
+	return AbsPath(foundAt) == AbsPath(file)
+}
+
+// AbsPath returns the absolute path of file, or the cleaned path if it can't be resolved.
+// Files are compared by their AbsPath.
+func AbsPath(file string) string {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return filepath.Clean(file)
+	}
+	return abs
+}
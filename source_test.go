@@ -0,0 +1,72 @@
+package ursonnet
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseRoot(t *testing.T) {
+	tests := []struct {
+		root string
+		file string
+		line int
+		ok   bool
+	}{
+		{"testdata/config.libsonnet:5 ", "testdata/config.libsonnet", 5, true},
+		{`C:\cfg\a.jsonnet:3`, `C:\cfg\a.jsonnet`, 3, true},
+		{"a.jsonnet", "", 0, false},
+		{"a.jsonnet:x", "", 0, false},
+	}
+	for _, test := range tests {
+		file, line, err := ParseRoot(test.root)
+		if (err == nil) != test.ok || file != test.file || line != test.line {
+			t.Errorf("ParseRoot(%q) = %q, %d, %v", test.root, file, line, err)
+		}
+	}
+}
+
+func TestParseRootColumn(t *testing.T) {
+	tests := []struct {
+		root         string
+		file         string
+		line, column int
+	}{
+		{"env.jsonnet:1:24 ", "env.jsonnet", 1, 24},
+		{"env.jsonnet:6", "env.jsonnet", 6, 0},
+		{`C:\cfg\env.jsonnet:1:10`, `C:\cfg\env.jsonnet`, 1, 10},
+	}
+	for _, test := range tests {
+		file, line, column, err := parseRootColumn(test.root)
+		if err != nil || file != test.file || line != test.line || column != test.column {
+			t.Errorf("parseRootColumn(%q) = %q, %d, %d, %v", test.root, file, line, column, err)
+		}
+		if file, line, err := ParseRoot(test.root); err != nil || file != test.file || line != test.line {
+			t.Errorf("ParseRoot(%q) = %q, %d, %v", test.root, file, line, err)
+		}
+	}
+}
+
+func TestMatchesFile(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		foundAt, file string
+		want          bool
+	}{
+		{"testdata/config.libsonnet", "testdata/config.libsonnet", true},
+		{"testdata/config.libsonnet", "./testdata/../testdata/config.libsonnet", true},
+		{"testdata/config.libsonnet", filepath.Join(wd, "testdata/config.libsonnet"), true},
+		{filepath.Join(wd, "testdata/config.libsonnet"), "testdata/config.libsonnet", true},
+		{"testdata/config.libsonnet", "config.libsonnet", false},
+		{"a/base/config.libsonnet", "base/config.libsonnet", false},
+		{"b/base/config.libsonnet", "a/base/config.libsonnet", false},
+	}
+	for _, test := range tests {
+		if got := matchesFile(test.foundAt, test.file); got != test.want {
+			t.Errorf("matchesFile(%q, %q) = %v, want %v", test.foundAt, test.file, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package ursonnet
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+)
+
+// SuggestOpt is an option for Suggest
+type SuggestOpt func(opts *suggestOptions)
+
+type suggestOptions struct{ libraryDirs []string }
+
+// LibraryDirs sets the library directories (typically the jsonnet import paths)
+// whose files Suggest only recommends if there is no alternative.
+// Files in a "vendor" directory are always treated as library files.
+func LibraryDirs(dirs ...string) SuggestOpt {
+	return func(opts *suggestOptions) {
+		opts.libraryDirs = append(opts.libraryDirs, dirs...)
+	}
+}
+
+// Suggestion is the root Suggest recommends editing in order to change a value.
+type Suggestion struct {
+	// Root is a "file:line" location as returned by Roots, or "file:line:column" for top-level arguments.
+	Root string
+	// Reason is a short human readable justification.
+	Reason string
+}
+
+func (s Suggestion) String() string {
+	return fmt.Sprintf("%s: %s", s.Root, s.Reason)
+}
+
+// candidate is a root that could be edited to change the value of the query.
+type candidate struct {
+	root    string
+	file    string
+	order   int
+	depth   int
+	library bool
+	literal bool
+	named   bool
+	name    string
+	// param is set for the parameters of entrypoints whose top level is a function.
+	param bool
+	// src and field are the source and field of the roots that aren't parameters.
+	src   *source
+	field *ast.DesugaredObjectField
+}
+
+// Suggest evaluates expr like Roots does, and picks among the roots the one a user most likely wants to
+// edit in order to change its value. Roots that merely forward a value computed elsewhere (like `a: self.b`
+// or `a: $.config.b`) are skipped; the remaining ones are ranked by preferring files outside library dirs,
+// fields named like the last step of expr, literals over computed values and files closer to the entrypoint,
+// i.e. the outermost override layer.
+func Suggest(vm *jsonnet.VM, filename string, expr string, opts ...SuggestOpt) (*Suggestion, error) {
+	var opt suggestOptions
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	roots, err := Roots(vm, filename, expr)
+	if err != nil {
+		return nil, err
+	}
+	cands, hops, parents, err := rankRoots(vm, filename, expr, roots, opt.libraryDirs)
+	if err != nil {
+		return nil, err
+	}
+	if len(cands) == 0 {
+		return nil, fmt.Errorf("no editable root found for %s", expr)
+	}
+
+	best := cands[0]
+	var reason []string
+	switch {
+	case best.param && best.literal:
+		reason = append(reason, fmt.Sprintf("default value of top-level argument %s", best.name))
+	case best.param:
+		reason = append(reason, fmt.Sprintf("top-level argument %s", best.name))
+	case best.literal:
+		reason = append(reason, fmt.Sprintf("literal value of %s", best.name))
+	default:
+		reason = append(reason, fmt.Sprintf("computes %s", best.name))
+	}
+	switch {
+	case best.depth == 0:
+		reason = append(reason, "in the entrypoint")
+	case parents[best.file] != "":
+		reason = append(reason, fmt.Sprintf("imported by %s", parents[best.file]))
+	}
+	var libs int
+	for _, c := range cands {
+		if c.library {
+			libs++
+		}
+	}
+	if best.library {
+		reason = append(reason, "only candidate roots are in library dirs")
+	} else if libs > 0 {
+		reason = append(reason, fmt.Sprintf("skipped %d roots in library dirs", libs))
+	}
+	if hops > 0 {
+		reason = append(reason, fmt.Sprintf("skipped %d reference hops", hops))
+	}
+
+	return &Suggestion{Root: best.root, Reason: strings.Join(reason, "; ")}, nil
+}
+
+// namedFirst returns the fields with the ones called name first, e.g. the field b of `a: {b: 1}`.
+func namedFirst(fields []*ast.DesugaredObjectField, name string) []*ast.DesugaredObjectField {
+	var named, others []*ast.DesugaredObjectField
+	for _, f := range fields {
+		if n, ok := f.Name.(*ast.LiteralString); ok && name != "" && n.Value == name {
+			named = append(named, f)
+		} else {
+			others = append(others, f)
+		}
+	}
+	return append(named, others...)
+}
+
+// rankRoots returns the roots of expr that could be edited to change its value, most likely first
+// (see Suggest), along with the number of reference hops skipped and the importers of the files (see importDepths).
+func rankRoots(vm *jsonnet.VM, filename string, expr string, roots []string, libraryDirs []string) ([]candidate, int, map[string]string, error) {
+	depths, parents, err := importDepths(vm, filename)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	var name string
+	if path, err := parseFieldPath(expr); err == nil && len(path) > 0 && !path[len(path)-1].IsIndex {
+		name = path[len(path)-1].Field
+	}
+
+	var (
+		cands   []candidate
+		hops    int
+		sources = map[string]*source{}
+	)
+	for i, r := range roots {
+		file, line, column, err := parseRootColumn(r)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		src, ok := sources[file]
+		if !ok {
+			if src, err = loadSource(vm, "", file); err != nil {
+				// e.g. fields defined in expr itself
+				continue
+			}
+			sources[file] = src
+		}
+		depth, ok := depths[file]
+		if !ok {
+			depth = len(depths)
+		}
+		for _, f := range namedFirst(src.fieldsAt(line), name) {
+			if isReference(f.Body) {
+				hops++
+				continue
+			}
+			c := candidate{
+				root:    strings.TrimSpace(r),
+				file:    file,
+				order:   i,
+				depth:   depth,
+				library: isLibrary(file, libraryDirs),
+				literal: isLiteral(f.Body),
+				src:     src,
+				field:   f,
+			}
+			if n, ok := f.Name.(*ast.LiteralString); ok {
+				c.name = n.Value
+				c.named = name != "" && n.Value == name
+			}
+			cands = append(cands, c)
+			break
+		}
+		if p := src.parameterAt(line, column); p != nil {
+			cands = append(cands, candidate{
+				root:    strings.TrimSpace(r),
+				file:    file,
+				order:   i,
+				depth:   depth,
+				library: isLibrary(file, libraryDirs),
+				literal: p.DefaultArg != nil && isLiteral(p.DefaultArg),
+				named:   name != "" && string(p.Name) == name,
+				name:    string(p.Name),
+				param:   true,
+			})
+		}
+	}
+
+	sort.SliceStable(cands, func(i, j int) bool {
+		a, b := cands[i], cands[j]
+		switch {
+		case a.library != b.library:
+			return !a.library
+		case a.named != b.named:
+			return a.named
+		case a.literal != b.literal:
+			return a.literal
+		case a.depth != b.depth:
+			return a.depth < b.depth
+		}
+		return a.order < b.order
+	})
+	return cands, hops, parents, nil
+}
+
+// isReference reports whether a only refers to a value defined elsewhere,
+// like `self.a`, `$.a.b`, `super.a` or a variable.
+func isReference(a ast.Node) bool {
+	switch a := a.(type) {
+	case *ast.Var, *ast.Self, *ast.Dollar:
+		return true
+	case *ast.SuperIndex:
+		return a.Index == nil || isLiteral(a.Index)
+	case *ast.Index:
+		return isReference(a.Target) && (a.Index == nil || isLiteral(a.Index))
+	}
+	return false
+}
+
+func isLibrary(file string, libraryDirs []string) bool {
+	clean := filepath.Clean(file)
+	for _, elem := range strings.Split(filepath.ToSlash(clean), "/") {
+		if elem == "vendor" {
+			return true
+		}
+	}
+	for _, dir := range libraryDirs {
+		if rel, err := filepath.Rel(filepath.Clean(dir), clean); err == nil && !strings.HasPrefix(rel, "..") {
+			return true
+		}
+	}
+	return false
+}
+
+// importDepths walks the imports breadth first starting from the entrypoint and returns, for each
+// file, the number of import hops from the entrypoint and the file that first imported it.
+func importDepths(vm *jsonnet.VM, filename string) (map[string]int, map[string]string, error) {
+	entry, err := loadSource(vm, "", filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	depths := map[string]int{entry.filename: 0}
+	parents := map[string]string{}
+	queue := []*source{entry}
+	for len(queue) > 0 {
+		src := queue[0]
+		queue = queue[1:]
+		for _, imp := range src.imports() {
+			dep, err := loadSource(vm, src.filename, imp)
+			if err != nil {
+				return nil, nil, err
+			}
+			if _, seen := depths[dep.filename]; seen {
+				continue
+			}
+			depths[dep.filename] = depths[src.filename] + 1
+			parents[dep.filename] = src.filename
+			queue = append(queue, dep)
+		}
+	}
+	return depths, parents, nil
+}
@@ -0,0 +1,87 @@
+package ursonnet
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+)
+
+func TestSuggest(t *testing.T) {
+	tests := []struct {
+		path   string
+		opts   []SuggestOpt
+		root   string
+		reason string
+	}{
+		{
+			path:   "$.deployment.spec.template.metadata.labels.app",
+			root:   "testdata/config.libsonnet:2",
+			reason: "literal value of Name; imported by testdata/base.jsonnet; skipped 4 reference hops",
+		},
+		{
+			path:   "$.deployment.spec.template.spec.containers[0].resources.requests.cpu",
+			root:   "testdata/config.libsonnet:5",
+			reason: "literal value of cpu; imported by testdata/base.jsonnet; skipped 2 reference hops",
+		},
+		{
+			path:   "$.deployment.metadata.name",
+			root:   "testdata/common.libsonnet:10",
+			reason: "literal value of name; imported by testdata/base.jsonnet",
+		},
+		{
+			path:   "$.deployment.metadata.name",
+			opts:   []SuggestOpt{LibraryDirs("testdata")},
+			root:   "testdata/common.libsonnet:10",
+			reason: "literal value of name; imported by testdata/base.jsonnet; only candidate roots are in library dirs",
+		},
+	}
+	for _, test := range tests {
+		s, err := Suggest(jsonnet.MakeVM(), "testdata/child.jsonnet", test.path, test.opts...)
+		if err != nil {
+			t.Errorf("%s: %v", test.path, err)
+			continue
+		}
+		if strings.TrimSpace(s.Root) != test.root || s.Reason != test.reason {
+			t.Errorf("%s: %s, want %s: %s", test.path, s, test.root, test.reason)
+		}
+	}
+
+	if s, err := Suggest(jsonnet.MakeVM(), "testdata/child.jsonnet", "{ a: 1 }.a"); err == nil {
+		t.Errorf("Suggest of a value defined in the query = %s, want an error", s)
+	}
+}
+
+func TestSuggestParameters(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "main.jsonnet")
+	const content = `function(env='dev', replicas=2) {
+  deployment: {
+    metadata: { name: env },
+    spec: { replicas: replicas },
+  },
+}
+`
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path   string
+		root   string
+		reason string
+	}{
+		{"$.deployment.spec.replicas", "1:21", "default value of top-level argument replicas; in the entrypoint; skipped 1 reference hops"},
+		{"$.deployment.metadata.name", "1:10", "default value of top-level argument env; in the entrypoint; skipped 1 reference hops"},
+	}
+	for _, test := range tests {
+		s, err := Suggest(jsonnet.MakeVM(), filename, test.path)
+		if err != nil {
+			t.Errorf("%s: %v", test.path, err)
+			continue
+		}
+		if want := filename + ":" + test.root; strings.TrimSpace(s.Root) != want || s.Reason != test.reason {
+			t.Errorf("%s: %s, want %s: %s", test.path, s, want, test.reason)
+		}
+	}
+}
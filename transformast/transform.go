@@ -11,12 +11,19 @@ type NodeTransformer func(ast.Node) (ast.Node, error)
 func Transform(node ast.Node, fun NodeTransformer) (res ast.Node, err error) {
 	type transformError struct{ error }
 
+	// optional children, like the default value of a parameter, are nil
+	if node == nil {
+		return nil, nil
+	}
+
 	// only captures panics issued by `tr` and converts them into normal errors
 	defer func() {
 		if r := recover(); r != nil {
-			if te, ok := r.(transformError); ok {
-				err = te.error
+			te, ok := r.(transformError)
+			if !ok {
+				panic(r)
 			}
+			err = te.error
 		}
 	}()
 
@@ -31,6 +38,12 @@ func Transform(node ast.Node, fun NodeTransformer) (res ast.Node, err error) {
 	switch node := (node).(type) {
 	case *ast.Apply:
 		tr(&node.Target)
+		for i := range node.Arguments.Positional {
+			tr(&node.Arguments.Positional[i].Expr)
+		}
+		for i := range node.Arguments.Named {
+			tr(&node.Arguments.Named[i].Arg)
+		}
 	case *ast.ApplyBrace:
 		tr(&node.Left)
 		tr(&node.Right)
@@ -60,6 +73,12 @@ func Transform(node ast.Node, fun NodeTransformer) (res ast.Node, err error) {
 		}
 		tr(&node.Body)
 	case *ast.DesugaredObject:
+		for i := range node.Asserts {
+			tr(&node.Asserts[i])
+		}
+		for i := range node.Locals {
+			tr(&node.Locals[i].Body)
+		}
 		for i := range node.Fields {
 			tr(&node.Fields[i].Name)
 			tr(&node.Fields[i].Body)
@@ -104,14 +123,14 @@ func Transform(node ast.Node, fun NodeTransformer) (res ast.Node, err error) {
 		for i := range node.Spec.Conditions {
 			tr(&node.Spec.Conditions[i].Expr)
 		}
-	case *ast.Import, *ast.ImportStr, *ast.Var:
+	case *ast.Import, *ast.ImportStr, *ast.ImportBin, *ast.Var:
 		// only literal children
 	case *ast.LiteralBoolean, *ast.LiteralNull, *ast.LiteralNumber, *ast.LiteralString:
 		// only literal children
 	case *ast.Self, *ast.Dollar:
 		// no children
 	default:
-		panic(fmt.Sprintf("unhandled type %T", node))
+		return nil, fmt.Errorf("unhandled type %T", node)
 	}
 	return fun(node)
 }
@@ -4,7 +4,9 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"log"
+	"strconv"
 	"strings"
 
 	"github.com/google/go-jsonnet"
@@ -42,7 +44,7 @@ func Roots(vm *jsonnet.VM, filename string, expr string, opts ...RootsOpt) ([]st
 		o(&opt)
 	}
 
-	root, err := jsonnet.SnippetToAST(ursonnetTraceTag, fmt.Sprintf("((import %q)+{ __ursonnet_res_:: %s}).__ursonnet_res_", filename, expr))
+	root, err := queryAST(filename, expr)
 	if err != nil {
 		return nil, err
 	}
@@ -51,10 +53,14 @@ func Roots(vm *jsonnet.VM, filename string, expr string, opts ...RootsOpt) ([]st
 		fmt.Println(unparse(root))
 	}
 
-	root, err = expandImports(vm, root, map[string]bool{})
+	files := map[string]ast.Node{}
+	root, err = expandImports(vm, root, files, nil)
 	if err != nil {
 		return nil, err
 	}
+	if root, err = liftFunction(vm, root, filename, files, true); err != nil {
+		return nil, err
+	}
 
 	if opt.debug {
 		fmt.Println("After import expansion:")
@@ -81,6 +87,12 @@ func Roots(vm *jsonnet.VM, filename string, expr string, opts ...RootsOpt) ([]st
 		log.Printf("Res: %s", evalResult)
 	}
 
+	return tracedRoots(&traceOut), nil
+}
+
+// tracedRoots returns the roots recorded in the trace output of an evaluation instrumented by injectTrace,
+// most relevant first.
+func tracedRoots(traceOut io.Reader) []string {
 	// the traceOut buffer will contain all user defined traces intermixed with the traces that we injected.
 	// All trace lines will look like:
 	//
@@ -89,15 +101,18 @@ func Roots(vm *jsonnet.VM, filename string, expr string, opts ...RootsOpt) ([]st
 	// Our traces will look like:
 	//    TRACE: <filename>:<linenumber> {{ursonnetTraceTag}}
 	//
-	// The top-level expression that evaluates `expr` is also traced, but we don't want the user to see that trace.
-	// It's easier to filter that line out here since for that line `<filename> == {ursonnetTraceTag}`
+	// or, for top-level arguments (see traceParameters):
+	//    TRACE: <filename>:<linenumber> :<column> {{ursonnetTraceTag}}
+	//
+	// The fields of the objects in `expr` itself are also traced, but we don't want the user to see those traces.
+	// It's easier to filter them out here since for them `<filename> == {ursonnetTraceTag}`
 
 	ignoreLine := fmt.Sprintf("TRACE: %s:1 %s", ursonnetTraceTag, ursonnetTraceTag)
 
 	seen := map[string]bool{}
 
 	var res []string
-	scanner := bufio.NewScanner(&traceOut)
+	scanner := bufio.NewScanner(traceOut)
 	for scanner.Scan() {
 		line := scanner.Text()
 		if strings.HasSuffix(line, ursonnetTraceTag) {
@@ -105,6 +120,11 @@ func Roots(vm *jsonnet.VM, filename string, expr string, opts ...RootsOpt) ([]st
 				continue
 			}
 			clean := strings.TrimPrefix(strings.TrimSuffix(line, ursonnetTraceTag), "TRACE: ")
+			if i := strings.LastIndex(clean, " :"); i >= 0 {
+				if _, err := strconv.Atoi(strings.TrimSpace(clean[i+2:])); err == nil {
+					clean = clean[:i] + clean[i+1:]
+				}
+			}
 			if !seen[clean] {
 				res = append(res, clean)
 				seen[clean] = true
@@ -112,22 +132,97 @@ func Roots(vm *jsonnet.VM, filename string, expr string, opts ...RootsOpt) ([]st
 		}
 	}
 	reverse(res)
+	return res
+}
+
+// Evaluate returns the JSON value of expr evaluated in the context of the jsonnet file identified by filename,
+// the same value Roots explains.
+func Evaluate(vm *jsonnet.VM, filename string, expr string) (string, error) {
+	return evaluatePatched(vm, filename, expr, nil)
+}
+
+// queryAST returns the AST of a query evaluating expr in the context of the file identified by filename,
+// where `$` is the top-level value of the file, whatever its type:
+//
+//	local $ = import "filename"; expr
+//
+// Such a local can't be written in jsonnet, so it's assembled from the ASTs of the import and of expr,
+// which is parsed as the field of an object for `$` to be accepted.
+func queryAST(filename string, expr string) (ast.Node, error) {
+	imp, err := jsonnet.SnippetToAST(ursonnetTraceTag, fmt.Sprintf("import %q", filename))
+	if err != nil {
+		return nil, err
+	}
+	wrapper, err := jsonnet.SnippetToAST(ursonnetTraceTag, fmt.Sprintf("{ __ursonnet_res_:: %s }", expr))
+	if err != nil {
+		return nil, err
+	}
+	o, ok := wrapper.(*ast.DesugaredObject)
+	if !ok || len(o.Fields) != 1 {
+		return nil, fmt.Errorf("invalid expression: %s", expr)
+	}
+	body := o.Fields[0].Body
+	q := &ast.Local{NodeBase: ast.NodeBase{LocRange: *body.Loc()}, Binds: ast.LocalBinds{{Variable: "$", Body: imp}}, Body: body}
+	q.SetFreeVariables(union(imp.FreeVariables(), without(body.FreeVariables(), ast.Identifiers{"$"})))
+	return q, nil
+}
+
+// evaluatePatched evaluates expr in the context of the entrypoint filename after expanding imports with the given patch.
+func evaluatePatched(vm *jsonnet.VM, filename string, expr string, patch patchFunc) (string, error) {
+	root, err := queryAST(filename, expr)
+	if err != nil {
+		return "", err
+	}
+	files := map[string]ast.Node{}
+	root, err = expandImports(vm, root, files, patch)
+	if err != nil {
+		return "", err
+	}
+	if root, err = liftFunction(vm, root, filename, files, false); err != nil {
+		return "", err
+	}
+	addStdFreeVariables(root, map[ast.Node]bool{})
 
-	return res, nil
+	return vm.Evaluate(root)
 }
 
-func expandImports(vm *jsonnet.VM, a ast.Node, seen map[string]bool) (ast.Node, error) {
+// patchFunc can modify the content of a jsonnet file before it's parsed by expandImports.
+type patchFunc func(filename string, content string) (string, error)
+
+// expandImports replaces imports with the AST of the imported files, recursively, and the data files parsed
+// from importstr with the AST of their values (see dataImport).
+// Files are parsed afresh instead of being taken from the VM import cache, since the result is later
+// modified in place (e.g. by injectTrace). Every file is parsed once: further imports of the same file
+// share its AST, which is recorded in files. If patch is not nil it's applied to the content of every
+// imported file.
+func expandImports(vm *jsonnet.VM, a ast.Node, files map[string]ast.Node, patch patchFunc) (ast.Node, error) {
 	return transformast.Transform(a, func(node ast.Node) (ast.Node, error) {
+		if data, ok, err := dataImport(vm, node, patch); ok || err != nil {
+			return data, err
+		}
 		if node, ok := node.(*ast.Import); ok {
-			a, foundAt, err := vm.ImportAST(node.Loc().FileName, node.File.Value)
+			content, foundAt, err := vm.ImportData(node.Loc().FileName, node.File.Value)
 			if err != nil {
 				return nil, err
 			}
-			if seen[foundAt] {
+			if a, ok := files[foundAt]; ok {
 				return a, nil
 			}
-			seen[foundAt] = true
-			return expandImports(vm, a, seen)
+			if patch != nil {
+				if content, err = patch(foundAt, content); err != nil {
+					return nil, err
+				}
+			}
+			a, err := jsonnet.SnippetToAST(foundAt, content)
+			if err != nil {
+				return nil, err
+			}
+			files[foundAt] = a
+			if a, err = expandImports(vm, a, files, patch); err != nil {
+				return nil, err
+			}
+			files[foundAt] = a
+			return a, nil
 		}
 		return node, nil
 	})
@@ -150,6 +245,13 @@ func injectTrace(a ast.Node, seen map[ast.Node]bool) error {
 	addFreeVariable("std", a)
 	addFreeVariable("$std", a) // this is a special variable used when desugaring comprehensions
 
+	// reading an ext var counts as a root, like top-level arguments do (see traceParameters)
+	if call, ok := a.(*ast.Apply); ok {
+		if _, ok := extVarName(call); ok {
+			seen[traceExtVar(call)] = true
+		}
+	}
+
 	if o, ok := a.(*ast.DesugaredObject); ok {
 		for i, field := range o.Fields {
 
@@ -185,6 +287,21 @@ func injectTrace(a ast.Node, seen map[ast.Node]bool) error {
 	return nil
 }
 
+// addStdFreeVariables percolates the "std" free variables up the tree like injectTrace does,
+// for inlined ASTs that are evaluated without tracing.
+func addStdFreeVariables(a ast.Node, seen map[ast.Node]bool) {
+	if seen[a] {
+		return
+	}
+	seen[a] = true
+
+	for _, c := range toolutils.Children(a) {
+		addStdFreeVariables(c, seen)
+	}
+	addFreeVariable("std", a)
+	addFreeVariable("$std", a)
+}
+
 func addFreeVariable(n ast.Identifier, a ast.Node) {
 	vars := a.FreeVariables()
 	for _, v := range vars {
@@ -0,0 +1,80 @@
+package ursonnet
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+)
+
+func TestRootsTopLevel(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib.libsonnet": `{
+  replicas: 1,
+}
+`,
+		"list.jsonnet": `local lib = import 'lib.libsonnet';
+[
+  lib,
+  lib { replicas: 3 },
+]
+`,
+		"string.jsonnet": `local lib = import 'lib.libsonnet';
+'replicas: %d' % lib.replicas
+`,
+		"env.jsonnet": `local lib = import 'lib.libsonnet';
+function(env) [
+  lib { env: env },
+]
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	at := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		file, expr string
+		value      string
+		roots      []string
+	}{
+		{"list.jsonnet", "$[1].replicas", "3\n", []string{at("list.jsonnet") + ":4"}},
+		{"list.jsonnet", "std.length($)", "2\n", nil},
+		{"string.jsonnet", "$", "\"replicas: 1\"\n", []string{at("lib.libsonnet") + ":2"}},
+		{"env.jsonnet", "$[0].env", "\"prod\"\n", []string{at("env.jsonnet") + ":3", at("env.jsonnet") + ":2:10"}},
+	}
+	newVM := func() *jsonnet.VM {
+		vm := jsonnet.MakeVM()
+		vm.TLAVar("env", "prod")
+		return vm
+	}
+	for _, test := range tests {
+		filename := at(test.file)
+		value, err := Evaluate(newVM(), filename, test.expr)
+		if err != nil || value != test.value {
+			t.Errorf("Evaluate(%s, %s) = %q, %v, want %q", test.file, test.expr, value, err, test.value)
+		}
+		roots, err := Roots(newVM(), filename, test.expr)
+		if err != nil || !reflect.DeepEqual(trimSpaces(roots), test.roots) {
+			t.Errorf("Roots(%s, %s) = %q, %v, want %q", test.file, test.expr, roots, err, test.roots)
+		}
+		cached, err := NewCache(newVM).Roots(filename, test.expr)
+		if err != nil || !reflect.DeepEqual(trimSpaces(cached), test.roots) {
+			t.Errorf("Cache.Roots(%s, %s) = %q, %v, want %q", test.file, test.expr, cached, err, test.roots)
+		}
+	}
+}
+
+func trimSpaces(roots []string) []string {
+	var res []string
+	for _, r := range roots {
+		res = append(res, strings.TrimSpace(r))
+	}
+	return res
+}
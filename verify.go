@@ -0,0 +1,133 @@
+package ursonnet
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/kubecfg/ursonnet/internal/unparser"
+)
+
+// RootStatus is the outcome of verifying a root.
+type RootStatus string
+
+const (
+	// RootConfirmed means that perturbing the root changed the value (or made the evaluation fail).
+	RootConfirmed RootStatus = "confirmed"
+	// RootIncidental means that the root was evaluated but perturbing it didn't change the value.
+	RootIncidental RootStatus = "incidental"
+	// RootUnverified means that the root is not a literal, so it was not perturbed.
+	RootUnverified RootStatus = "unverified"
+)
+
+// VerifiedRoot is a root as returned by Roots along with the outcome of its verification.
+type VerifiedRoot struct {
+	Root   string
+	Status RootStatus
+}
+
+func (v VerifiedRoot) String() string {
+	return fmt.Sprintf("%s %s", strings.TrimSpace(v.Root), v.Status)
+}
+
+// Verify checks empirically which of the roots returned by Roots actually affect the value of expr.
+// Roots over-approximates, since every field forced during the evaluation is reported.
+// Verify perturbs, in memory, the literals defined at each root and evaluates expr again:
+// if the value changes the root is confirmed, otherwise it's incidental.
+// This costs an extra evaluation per literal root.
+func Verify(vm *jsonnet.VM, filename string, expr string, roots []string) ([]VerifiedRoot, error) {
+	want, err := evaluatePatched(vm, filename, expr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]VerifiedRoot, len(roots))
+	for i, r := range roots {
+		res[i] = VerifiedRoot{Root: r, Status: RootUnverified}
+
+		file, line, err := ParseRoot(r)
+		if err != nil {
+			return nil, err
+		}
+		perturbed := false
+		got, err := evaluatePatched(vm, filename, expr, func(foundAt, content string) (string, error) {
+			if !matchesFile(foundAt, file) {
+				return content, nil
+			}
+			var err error
+			content, perturbed, err = perturb(foundAt, content, line)
+			return content, err
+		})
+		switch {
+		case !perturbed:
+		case err != nil || got != want:
+			res[i].Status = RootConfirmed
+		default:
+			res[i].Status = RootIncidental
+		}
+	}
+	return res, nil
+}
+
+// perturb changes the value of every literal field defined at the given line, keeping its type.
+func perturb(filename, content string, line int) (string, bool, error) {
+	src, err := parseSource(filename, content)
+	if err != nil {
+		return "", false, err
+	}
+
+	var bodies []ast.Node
+	for _, f := range src.fieldsAt(line) {
+		if isLiteral(f.Body) {
+			bodies = append(bodies, f.Body)
+		}
+	}
+	content, err = perturbBodies(src, bodies)
+	return content, len(bodies) > 0, err
+}
+
+// perturbBodies returns the content of src with the literals of bodies changed, keeping their type.
+func perturbBodies(src *source, bodies []ast.Node) (string, error) {
+	copied := *src
+	src = &copied
+	bodies = append([]ast.Node{}, bodies...)
+	// splice from the end, so that earlier offsets stay valid
+	sort.Slice(bodies, func(i, j int) bool {
+		return src.offset(bodies[i].Loc().Begin) > src.offset(bodies[j].Loc().Begin)
+	})
+	for _, b := range bodies {
+		r := *b.Loc()
+		orig := src.content[src.offset(r.Begin):src.offset(r.End)]
+		var text string
+		switch b := b.(type) {
+		case *ast.LiteralNumber:
+			if src.data {
+				// data files hold plain numbers, which can't be computed upon
+				f, err := strconv.ParseFloat(b.OriginalString, 64)
+				if err != nil {
+					return "", err
+				}
+				text = strconv.FormatFloat(f+1, 'g', -1, 64)
+			} else {
+				text = fmt.Sprintf("(%s + 1)", orig)
+			}
+		case *ast.LiteralBoolean:
+			if src.data {
+				text = strconv.FormatBool(!b.Value)
+			} else {
+				text = fmt.Sprintf("(!%s)", orig)
+			}
+		case *ast.LiteralString:
+			text = unparser.Quote(b.Value+"~", unparser.StringStyleDouble)
+		case *ast.LiteralNull:
+			text = `"~"`
+		default:
+			text = fmt.Sprintf("(%s + 1)", orig)
+		}
+		src.content = src.splice(r, text)
+	}
+	return src.content, nil
+}
@@ -0,0 +1,85 @@
+package ursonnet
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+)
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib.libsonnet": `{
+  threshold: 1,
+  replicas: 3,
+  name: 'foo',
+}
+`,
+		"main.jsonnet": `local lib = import 'lib.libsonnet';
+{
+  size: if lib.replicas > lib.threshold then 'big' else 'small',
+  name: lib.name,
+}
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	tests := []struct {
+		path string
+		want map[string]RootStatus
+	}{
+		{"$.size", map[string]RootStatus{
+			"lib.libsonnet:2": RootIncidental,
+			"lib.libsonnet:3": RootIncidental,
+			"main.jsonnet:3":  RootUnverified,
+		}},
+		{"$.name", map[string]RootStatus{
+			"lib.libsonnet:4": RootConfirmed,
+			"main.jsonnet:4":  RootUnverified,
+		}},
+	}
+	for _, test := range tests {
+		roots, err := Roots(jsonnet.MakeVM(), "main.jsonnet", test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the roots can be written differently from the paths the importer finds
+		for _, form := range []func(string) string{
+			func(r string) string { return r },
+			func(r string) string { return "./" + r },
+			func(r string) string { return filepath.Join(dir, r) },
+		} {
+			var written []string
+			for _, r := range roots {
+				written = append(written, form(strings.TrimSpace(r)))
+			}
+			verified, err := Verify(jsonnet.MakeVM(), "main.jsonnet", test.path, written)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]RootStatus{}
+			for i, v := range verified {
+				got[strings.TrimSpace(roots[i])] = v.Status
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("%s with roots %q: %v, want %v", test.path, written, got, test.want)
+			}
+		}
+	}
+}
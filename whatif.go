@@ -0,0 +1,225 @@
+package ursonnet
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+)
+
+// Override replaces, in memory, the value of the field defined at a source location
+// (or, if Path is set, the literal root of a field path) with a jsonnet expression.
+type Override struct {
+	File string
+	Line int
+	Path string
+	Expr string
+}
+
+// ParseOverride parses overrides written as `file:line=expr` or `$.field.path=expr`.
+func ParseOverride(s string) (Override, error) {
+	i := indexAssign(s)
+	if i < 0 {
+		return Override{}, fmt.Errorf("override %q must be written as file:line=expr or $.path=expr", s)
+	}
+	loc, expr := s[:i], s[i+1:]
+	if strings.HasPrefix(loc, "$") {
+		return Override{Path: loc, Expr: expr}, nil
+	}
+	file, line, err := ParseRoot(loc)
+	if err != nil {
+		return Override{}, fmt.Errorf("bad override location %q: %w", loc, err)
+	}
+	return Override{File: file, Line: line, Expr: expr}, nil
+}
+
+// indexAssign returns the index of the first `=` that is not part of a quoted field name.
+func indexAssign(s string) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '=':
+			return i
+		}
+	}
+	return -1
+}
+
+func (o Override) String() string {
+	if o.Path != "" {
+		return fmt.Sprintf("%s=%s", o.Path, o.Expr)
+	}
+	return fmt.Sprintf("%s:%d=%s", o.File, o.Line, o.Expr)
+}
+
+// matches reports whether the override applies to the file found at foundAt.
+func (o Override) matches(foundAt string) bool {
+	return matchesFile(foundAt, o.File)
+}
+
+// WhatIfResult describes how the output changes when overrides are applied.
+type WhatIfResult struct {
+	// Before and After are the JSON values of the query expression.
+	Before string
+	After  string
+	// Changes lists the fields of the whole output whose value changed.
+	Changes []Change
+}
+
+// WhatIf evaluates the jsonnet file identified by filename and expr (like Roots does), with and without
+// the overrides, and reports how the value of expr and the rest of the output change.
+// Overrides are applied in memory while expanding imports, so no file is modified.
+func WhatIf(vm *jsonnet.VM, filename string, expr string, overrides []Override) (*WhatIfResult, error) {
+	var resolved []Override
+	for _, o := range overrides {
+		if o.Path != "" {
+			roots, err := Roots(vm, filename, o.Path)
+			if err != nil {
+				return nil, err
+			}
+			src, field, err := findLiteralRoot(vm, filename, o.Path, roots, nil)
+			if err != nil {
+				return nil, err
+			}
+			if src == nil {
+				return nil, fmt.Errorf("no literal root found for %s", o.Path)
+			}
+			o = Override{File: src.filename, Line: field.LocRange.Begin.Line, Expr: o.Expr}
+		}
+		resolved = append(resolved, o)
+	}
+
+	before, err := evaluateWithPatch(vm, filename, expr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]bool, len(resolved))
+	after, err := evaluateWithPatch(vm, filename, expr, func(foundAt, content string) (string, error) {
+		for i, o := range resolved {
+			if !o.matches(foundAt) {
+				continue
+			}
+			var err error
+			if content, err = applyOverride(foundAt, content, o); err != nil {
+				return "", fmt.Errorf("override %s: %w", o, err)
+			}
+			applied[i] = true
+		}
+		return content, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, ok := range applied {
+		if !ok {
+			return nil, fmt.Errorf("override %s: file not imported by %s", resolved[i], filename)
+		}
+	}
+
+	changes, err := diffJSON(before.output, after.output)
+	if err != nil {
+		return nil, err
+	}
+	return &WhatIfResult{Before: before.query, After: after.query, Changes: changes}, nil
+}
+
+// applyOverride replaces the body of the field defined at o.Line with o.Expr.
+// Overrides are applied to the text rather than the AST so that the expression
+// is resolved in the scope of the field, like if it was written there.
+// In YAML and JSON data files, the expression is evaluated on its own and its value written as JSON.
+func applyOverride(filename, content string, o Override) (string, error) {
+	src, err := parseSource(filename, content)
+	if err != nil {
+		return "", err
+	}
+	expr := "(" + o.Expr + ")"
+	if src.data {
+		if expr, err = dataValue(o.Expr); err != nil {
+			return "", fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	return replaceFieldBody(filename, content, o.Line, func(string) string {
+		return expr
+	})
+}
+
+// replaceFieldBody replaces the body of the field defined at line with the text returned by replace,
+// which is given the text of the body.
+func replaceFieldBody(filename, content string, line int, replace func(body string) string) (string, error) {
+	src, err := parseSource(filename, content)
+	if err != nil {
+		return "", err
+	}
+	fields := outermost(src.fieldsAt(line))
+	switch {
+	case len(fields) == 0:
+		return "", fmt.Errorf("no field defined at %s:%d", filename, line)
+	case len(fields) > 1:
+		return "", fmt.Errorf("%d fields defined at %s:%d", len(fields), filename, line)
+	}
+	body := fields[0].Body.Loc()
+	if body == nil || body.Begin.Line == 0 || (src.data && body.Begin == body.End) {
+		return "", fmt.Errorf("cannot locate the value of the field at %s:%d", filename, line)
+	}
+	return src.splice(*body, replace(src.content[src.offset(body.Begin):src.offset(body.End)])), nil
+}
+
+// outermost returns the fields that aren't nested in another one, like the fields of an object written
+// inline in the value of a field.
+func outermost(fields []*ast.DesugaredObjectField) []*ast.DesugaredObjectField {
+	var res []*ast.DesugaredObjectField
+	for _, f := range fields {
+		nested := false
+		for _, g := range fields {
+			nested = nested || (g != f && encloses(g.LocRange, f.LocRange))
+		}
+		if !nested {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// encloses reports whether the location range r contains s.
+func encloses(r, s ast.LocationRange) bool {
+	return !before(s.Begin, r.Begin) && !before(r.End, s.End)
+}
+
+type evaluation struct {
+	// output is the JSON value of the whole file, query the one of the query expression.
+	output string
+	query  string
+}
+
+// evaluateWithPatch evaluates both the whole jsonnet file and the query expression,
+// patching the content of the imported files with patch.
+func evaluateWithPatch(vm *jsonnet.VM, filename string, expr string, patch patchFunc) (*evaluation, error) {
+	res, err := evaluatePatched(vm, filename, fmt.Sprintf("[$, (%s)]", expr), patch)
+	if err != nil {
+		return nil, err
+	}
+	var pair []json.RawMessage
+	if err := json.Unmarshal([]byte(res), &pair); err != nil {
+		return nil, err
+	}
+	return &evaluation{output: string(pair[0]), query: compactJSON(pair[1])}, nil
+}
+
+func compactJSON(b []byte) string {
+	v, err := decodeJSON(string(b))
+	if err != nil {
+		return string(b)
+	}
+	return toJSON(v)
+}
@@ -0,0 +1,153 @@
+package ursonnet
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+)
+
+func TestParseOverride(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Override
+	}{
+		{`config.libsonnet:5="4"`, Override{File: "config.libsonnet", Line: 5, Expr: `"4"`}},
+		{`a/b.jsonnet:12=self.x == 1`, Override{File: "a/b.jsonnet", Line: 12, Expr: "self.x == 1"}},
+		{`C:\cfg\a.jsonnet:3=1`, Override{File: `C:\cfg\a.jsonnet`, Line: 3, Expr: "1"}},
+		{`$.conf.Name="other"`, Override{Path: "$.conf.Name", Expr: `"other"`}},
+		{`$["a=b"].c=1`, Override{Path: `$["a=b"].c`, Expr: "1"}},
+		{`$['a\'=b']=1`, Override{Path: `$['a\'=b']`, Expr: "1"}},
+		{`$.a=`, Override{Path: "$.a", Expr: ""}},
+	}
+	for _, test := range tests {
+		got, err := ParseOverride(test.in)
+		if err != nil {
+			t.Errorf("ParseOverride(%q): %v", test.in, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseOverride(%q) = %+v, want %+v", test.in, got, test.want)
+		}
+		if got.String() != test.in {
+			t.Errorf("ParseOverride(%q).String() = %q", test.in, got.String())
+		}
+	}
+}
+
+func TestParseOverrideErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"config.libsonnet:5",
+		"config.libsonnet=1",
+		"config.libsonnet:x=1",
+		`$["a=b"]`,
+	} {
+		if o, err := ParseOverride(in); err == nil {
+			t.Errorf("ParseOverride(%q) = %+v, want an error", in, o)
+		}
+	}
+}
+
+func TestWhatIf(t *testing.T) {
+	const cpu = "$.deployment.spec.template.spec.containers[0].resources.limits.cpu"
+	tests := []struct {
+		name     string
+		override string
+		after    string
+		changes  []string
+	}{
+		{
+			name:     "file and line",
+			override: `testdata/config.libsonnet:5="4"`,
+			after:    `"4"`,
+			changes: []string{
+				"$.deployment.spec.template.spec.containers[0].resources.limits.cpu",
+				"$.deployment.spec.template.spec.containers[0].resources.requests.cpu",
+			},
+		},
+		{
+			name:     "field path",
+			override: cpu + `="8"`,
+			after:    `"8"`,
+			changes: []string{
+				"$.deployment.spec.template.spec.containers[0].resources.limits.cpu",
+				"$.deployment.spec.template.spec.containers[0].resources.requests.cpu",
+			},
+		},
+		{
+			name:     "unrelated field",
+			override: `testdata/config.libsonnet:2="other"`,
+			after:    `"2"`,
+			changes: []string{
+				"$.deployment.spec.template.metadata.labels.app",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o, err := ParseOverride(test.override)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := WhatIf(jsonnet.MakeVM(), "testdata/child.jsonnet", cpu, []Override{o})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.TrimSpace(res.Before) != `"2"` || strings.TrimSpace(res.After) != test.after {
+				t.Errorf("%s -> %s, want \"2\" -> %s", res.Before, res.After, test.after)
+			}
+			var changes []string
+			for _, c := range res.Changes {
+				changes = append(changes, c.Path)
+			}
+			if !reflect.DeepEqual(changes, test.changes) {
+				t.Errorf("changes = %q, want %q", changes, test.changes)
+			}
+		})
+	}
+}
+
+func TestWhatIfUnmatchedFile(t *testing.T) {
+	o, err := ParseOverride(`config.libsonnet:5="4"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WhatIf(jsonnet.MakeVM(), "testdata/child.jsonnet", "$", []Override{o}); err == nil {
+		t.Error("an override of a file that isn't imported succeeded")
+	}
+}
+
+func TestWhatIfData(t *testing.T) {
+	tests := []struct {
+		override string
+		after    string
+	}{
+		{`testdata/values.yaml:2="a\\b"`, `"a\\b"`},
+		{`testdata/values.yaml:2=std.join(':', ['foo', '2'])`, `"foo:2"`},
+		{`$.image={image: 'foo'}.image`, `"foo"`},
+	}
+	for _, test := range tests {
+		o, err := ParseOverride(test.override)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := WhatIf(jsonnet.MakeVM(), "testdata/data.jsonnet", "$.image", []Override{o})
+		if err != nil {
+			t.Errorf("%s: %v", test.override, err)
+			continue
+		}
+		if strings.TrimSpace(res.After) != test.after {
+			t.Errorf("%s: $.image = %s, want %s", test.override, res.After, test.after)
+		}
+	}
+
+	o, err := ParseOverride(`testdata/values.yaml:2=self.replicas`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WhatIf(jsonnet.MakeVM(), "testdata/data.jsonnet", "$.image", []Override{o}); err == nil {
+		t.Error("an override of a data file with a reference succeeded")
+	}
+}
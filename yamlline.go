@@ -0,0 +1,130 @@
+package ursonnet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// YAMLLine is the value at a line of a YAML stream of Kubernetes objects, like the output of kubecfg show.
+type YAMLLine struct {
+	// Object is the object of the line.
+	Object Object
+	// Field is the field path of the value at the line, relative to the object, like `.spec.replicas`.
+	Field string
+	// Text is the content of the line.
+	Text string
+}
+
+// RenderYAML renders the Kubernetes objects of a JSON output as a YAML stream, like kubecfg show does.
+func RenderYAML(output string) (string, error) {
+	objs, err := Objects(output)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, o := range objs {
+		y, err := sigsyaml.JSONToYAML([]byte(toJSON(o.Value)))
+		if err != nil {
+			return "", err
+		}
+		b.WriteString("---\n")
+		b.Write(y)
+	}
+	return b.String(), nil
+}
+
+// LocateYAMLLine finds the value at a line, numbered from 1, of a YAML stream of Kubernetes objects.
+// The lines of multi-line values belong to them; the line of a key belongs to its value.
+func LocateYAMLLine(content string, line int) (*YAMLLine, error) {
+	lines := strings.Split(content, "\n")
+	if line < 1 || line > len(lines) {
+		return nil, fmt.Errorf("line %d out of range: there are %d lines", line, len(lines))
+	}
+	text := strings.TrimSpace(lines[line-1])
+	if text == "" || text == "---" || text == "..." || strings.HasPrefix(text, "#") {
+		return nil, fmt.Errorf("no value at line %d", line)
+	}
+
+	// the line belongs to the last document starting before it
+	var doc *yaml.Node
+	d := yaml.NewDecoder(strings.NewReader(content))
+	for {
+		var n yaml.Node
+		if err := d.Decode(&n); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if n.Line > line {
+			break
+		}
+		doc = &n
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("no value at line %d", line)
+	}
+	var at fieldPath
+	locateLine(doc, nil, line, &at)
+
+	var v interface{}
+	if err := doc.Decode(&v); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := Objects(string(b))
+	if err != nil {
+		return nil, err
+	}
+	path := at.String()
+	for _, o := range objs {
+		if path == o.Path || nestedIn(path, o.Path) {
+			return &YAMLLine{Object: o, Field: strings.TrimPrefix(path, o.Path), Text: text}, nil
+		}
+	}
+	return nil, fmt.Errorf("line %d is not in a Kubernetes object", line)
+}
+
+// locateLine records in at the path of the last value in document order that starts at or before line.
+func locateLine(n *yaml.Node, path fieldPath, line int, at *fieldPath) {
+	if n.Line > line {
+		return
+	}
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, c := range n.Content {
+			locateLine(c, path, line, at)
+		}
+		return
+	case yaml.MappingNode:
+		*at = path
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			if k.Line > line {
+				break
+			}
+			p := path.append(pathElem{Field: k.Value})
+			*at = p
+			locateLine(v, p, line, at)
+		}
+	case yaml.SequenceNode:
+		*at = path
+		for i, c := range n.Content {
+			locateLine(c, path.append(pathElem{Index: i, IsIndex: true}), line, at)
+		}
+	default:
+		*at = path
+	}
+}
+
+// nestedIn reports whether the field path p is nested in the field path q.
+func nestedIn(p, q string) bool {
+	return strings.HasPrefix(p, q+".") || strings.HasPrefix(p, q+"[")
+}
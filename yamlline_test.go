@@ -0,0 +1,101 @@
+package ursonnet
+
+import (
+	"strings"
+	"testing"
+)
+
+const renderedYAML = `# rendered
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: foo
+  namespace: ns
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: foo
+        image: foo:1
+        args:
+        - --a
+        - |
+          multi
+          line
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata: {name: cm}
+  data:
+    a.b: c
+`
+
+func TestLocateYAMLLine(t *testing.T) {
+	tests := []struct {
+		line   int
+		object string
+		field  string
+	}{
+		{3, "apps/v1/Deployment/ns/foo", ".apiVersion"},
+		{5, "apps/v1/Deployment/ns/foo", ".metadata"},
+		{6, "apps/v1/Deployment/ns/foo", ".metadata.name"},
+		{9, "apps/v1/Deployment/ns/foo", ".spec.replicas"},
+		{13, "apps/v1/Deployment/ns/foo", ".spec.template.spec.containers[0].name"},
+		{14, "apps/v1/Deployment/ns/foo", ".spec.template.spec.containers[0].image"},
+		{16, "apps/v1/Deployment/ns/foo", ".spec.template.spec.containers[0].args[0]"},
+		{17, "apps/v1/Deployment/ns/foo", ".spec.template.spec.containers[0].args[1]"},
+		{19, "apps/v1/Deployment/ns/foo", ".spec.template.spec.containers[0].args[1]"},
+		{24, "v1/ConfigMap/cm", ".apiVersion"},
+		{26, "v1/ConfigMap/cm", ".metadata.name"},
+		{28, "v1/ConfigMap/cm", `.data["a.b"]`},
+	}
+	for _, test := range tests {
+		got, err := LocateYAMLLine(renderedYAML, test.line)
+		if err != nil {
+			t.Errorf("line %d: %v", test.line, err)
+			continue
+		}
+		if got.Object.Address() != test.object || got.Field != test.field {
+			t.Errorf("line %d: %s:%s, want %s:%s", test.line, got.Object.Address(), got.Field, test.object, test.field)
+		}
+	}
+
+	for _, line := range []int{0, 1, 2, 20, 21, 22, 23, 100} {
+		if got, err := LocateYAMLLine(renderedYAML, line); err == nil {
+			t.Errorf("line %d: %s:%s, want an error", line, got.Object.Address(), got.Field)
+		}
+	}
+}
+
+func TestRenderYAML(t *testing.T) {
+	yaml, err := RenderYAML(k8sOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, err := Objects(k8sOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every object is a document starting with its apiVersion
+	var n int
+	for line := 1; line <= strings.Count(yaml, "\n"); line++ {
+		at, err := LocateYAMLLine(yaml, line)
+		if err != nil {
+			continue
+		}
+		if at.Field == ".apiVersion" {
+			if at.Object.Address() != objs[n].Address() {
+				t.Errorf("object %d is %s, want %s", n, at.Object.Address(), objs[n].Address())
+			}
+			n++
+		}
+	}
+	if n != len(objs) {
+		t.Errorf("found %d objects, want %d:\n%s", n, len(objs), yaml)
+	}
+}